@@ -0,0 +1,171 @@
+package idast
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+const (
+	markerPrefix = "/*@id:"
+	markerSuffix = "*/"
+)
+
+// Annotate returns src, the source of file as parsed into fset, with an
+// inline marker comment of the form
+//
+//	/*@id:Decls/0/FuncDecl:A*/
+//
+// immediately after the last token of each node, giving its ID. Markers of
+// nodes that end at the same place are in walk post-order: inner nodes
+// first. Comments are not marked, and neither is the file itself. Marking
+// the end of a node rather than its start keeps doc comments attached to
+// their declarations.
+func Annotate(fset *token.FileSet, file *ast.File, src []byte) ([]byte, error) {
+	return defaultConfig.Annotate(fset, file, src)
+}
+
+// Annotate is like the package-level Annotate, computing IDs as configured by
+// cfg.
+func (cfg *Config) Annotate(fset *token.FileSet, file *ast.File, src []byte) ([]byte, error) {
+	tf := fset.File(file.Pos())
+	if tf == nil || tf.Size() != len(src) {
+		return nil, fmt.Errorf("idast.Annotate: src is not the source of file")
+	}
+
+	type marker struct {
+		offset int
+		id     string
+	}
+	var markers []marker
+	var stack []NodeWithId
+	cfg.Walk(visitorFunc(func(n ast.Node, id NodeId) {
+		if n != nil {
+			stack = append(stack, NodeWithId{n, id.dup()})
+			return
+		}
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch top.Node.(type) {
+		case *ast.Comment, *ast.CommentGroup:
+			return
+		}
+		if end := top.Node.End(); end.IsValid() && len(top.Id) > 0 {
+			markers = append(markers, marker{tf.Offset(end), top.Id.String()})
+		}
+	}), file)
+	sort.SliceStable(markers, func(i, j int) bool {
+		return markers[i].offset < markers[j].offset
+	})
+
+	var b bytes.Buffer
+	last := 0
+	for _, m := range markers {
+		b.Write(src[last:m.offset])
+		b.WriteString(markerPrefix + m.id + markerSuffix)
+		last = m.offset
+	}
+	b.Write(src[last:])
+	return b.Bytes(), nil
+}
+
+// A visitorFunc is a Visitor that calls itself for every node and for the
+// nil that follows each node's children.
+type visitorFunc func(ast.Node, NodeId)
+
+func (f visitorFunc) Visit(n ast.Node, id NodeId) Visitor {
+	f(n, id)
+	return f
+}
+
+// ParseAnnotated parses src, as produced by Annotate, and returns the file
+// and the IDs given by its markers. The markers are removed from the file's
+// comments; positions remain those of the annotated source.
+func ParseAnnotated(fset *token.FileSet, filename string, src []byte) (*ast.File, map[ast.Node]NodeId, error) {
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Queue the IDs of each run of adjacent markers by the position the run
+	// starts at, which is where the marked nodes end.
+	ids := make(map[token.Pos][]NodeId)
+	var comments []*ast.CommentGroup
+	for _, g := range file.Comments {
+		var list []*ast.Comment
+		runStart, runEnd := token.NoPos, token.NoPos
+		for _, c := range g.List {
+			if !strings.HasPrefix(c.Text, markerPrefix) || !strings.HasSuffix(c.Text, markerSuffix) {
+				list = append(list, c)
+				continue
+			}
+			if c.Slash != runEnd {
+				runStart = c.Slash
+			}
+			runEnd = c.End()
+			id := ParseNodeId(c.Text[len(markerPrefix) : len(c.Text)-len(markerSuffix)])
+			ids[runStart] = append(ids[runStart], id)
+		}
+		g.List = list
+		if len(list) > 0 {
+			comments = append(comments, g)
+		}
+	}
+	file.Comments = comments
+
+	m := make(map[ast.Node]NodeId)
+	var stack []ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n != nil {
+			stack = append(stack, n)
+			dropEmptyComments(n)
+			return true
+		}
+		n = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch n.(type) {
+		case *ast.Comment, *ast.CommentGroup:
+			return true
+		}
+		if q := ids[n.End()]; len(q) > 0 {
+			m[n] = q[0]
+			ids[n.End()] = q[1:]
+		}
+		return true
+	})
+	return file, m, nil
+}
+
+// dropEmptyComments clears the Doc and Comment fields of n that refer to
+// comment groups left empty by removing markers.
+func dropEmptyComments(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.File:
+		if n.Doc != nil && len(n.Doc.List) == 0 {
+			n.Doc = nil
+		}
+	case *ast.Field:
+		n.Doc, n.Comment = nonEmpty(n.Doc), nonEmpty(n.Comment)
+	case *ast.ImportSpec:
+		n.Doc, n.Comment = nonEmpty(n.Doc), nonEmpty(n.Comment)
+	case *ast.ValueSpec:
+		n.Doc, n.Comment = nonEmpty(n.Doc), nonEmpty(n.Comment)
+	case *ast.TypeSpec:
+		n.Doc, n.Comment = nonEmpty(n.Doc), nonEmpty(n.Comment)
+	case *ast.GenDecl:
+		n.Doc = nonEmpty(n.Doc)
+	case *ast.FuncDecl:
+		n.Doc = nonEmpty(n.Doc)
+	}
+}
+
+func nonEmpty(g *ast.CommentGroup) *ast.CommentGroup {
+	if g != nil && len(g.List) == 0 {
+		return nil
+	}
+	return g
+}
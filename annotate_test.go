@@ -0,0 +1,76 @@
+package idast
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAnnotate(t *testing.T) {
+	src := "package p\n\n// A does a.\nfunc A(x int) int {\n\treturn x + 1 // one more\n}\n"
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	annotated, err := Annotate(fset, file, []byte(src))
+	if err != nil {
+		t.Fatalf("Annotate: %v", err)
+	}
+	want := "\treturn x/*@id:Decls/0/FuncDecl:A/Body/BlockStmt/List/0/ReturnStmt/Results/0/BinaryExpr/X/Ident*/ + 1" +
+		"/*@id:Decls/0/FuncDecl:A/Body/BlockStmt/List/0/ReturnStmt/Results/0/BinaryExpr/Y/BasicLit*/" +
+		"/*@id:Decls/0/FuncDecl:A/Body/BlockStmt/List/0/ReturnStmt/Results/0/BinaryExpr*/" +
+		"/*@id:Decls/0/FuncDecl:A/Body/BlockStmt/List/0/ReturnStmt*/ // one more\n"
+	if !strings.Contains(string(annotated), want) {
+		t.Errorf("want annotated source to contain:\n%s\ngot:\n%s", want, annotated)
+	}
+}
+
+func TestAnnotateRoundTrip(t *testing.T) {
+	src, err := os.ReadFile("testdata/print.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "testdata/print.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("Error parsing testdata/print.go: %v", err)
+	}
+	annotated, err := Annotate(fset, file, src)
+	if err != nil {
+		t.Fatalf("Annotate: %v", err)
+	}
+
+	parsed, ids, err := ParseAnnotated(token.NewFileSet(), "annotated.go", annotated)
+	if err != nil {
+		t.Fatalf("ParseAnnotated: %v", err)
+	}
+	want := Map(parsed)
+	if len(Map(file)) != len(want) {
+		t.Errorf("want %d nodes after round trip, got %d", len(Map(file)), len(want))
+	}
+	n := 0
+	for node, id := range want {
+		switch node.(type) {
+		case *ast.File, *ast.Comment, *ast.CommentGroup:
+			continue
+		}
+		n++
+		if got := ids[node]; got.String() != id.String() {
+			t.Errorf("%T: want %v, got %v", node, id.String(), got.String())
+		}
+	}
+	if len(ids) != n {
+		t.Errorf("want %d recovered IDs, got %d", n, len(ids))
+	}
+	for _, g := range parsed.Comments {
+		for _, c := range g.List {
+			if strings.HasPrefix(c.Text, markerPrefix) {
+				t.Errorf("want markers removed, got %s", c.Text)
+			}
+		}
+	}
+}
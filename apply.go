@@ -0,0 +1,306 @@
+package idast
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+)
+
+// An ApplyFunc is invoked by Apply for each node n, even if n is nil,
+// before and/or after the node's children, using a Cursor describing the
+// current node and providing operations on it.
+//
+// The return value of ApplyFunc controls the syntax tree traversal. See
+// Apply for details.
+type ApplyFunc func(*Cursor) bool
+
+// Apply traverses a syntax tree recursively, starting with root, and
+// calling pre and post for each node:
+//
+//   - If pre is not nil, it is called for each node before the node's
+//     children are traversed (pre-order). If pre returns false, no children
+//     are traversed, and post is not called for that node.
+//   - If post is not nil, and a prior call of pre didn't return false, post
+//     is called for each node after its children are traversed (post-order).
+//     If post returns false, traversal is terminated and Apply returns
+//     immediately.
+//
+// Only fields that Walk visits are traversed, in the same order, and the
+// cursor's Id is the node's ID as computed by Walk. IDs are those of the
+// tree as it was when each node's parent was entered. Nodes inserted with
+// InsertBefore or InsertAfter and replacement nodes are not traversed,
+// although post is called for a node that pre replaced.
+//
+// Children are found by pointer identity, so a node must not appear more
+// than once in the tree. Apply returns the (possibly replaced) root.
+func Apply(root ast.Node, pre, post ApplyFunc) ast.Node {
+	return defaultConfig.Apply(root, pre, post)
+}
+
+// Apply is like the package-level Apply, computing IDs as configured by cfg.
+func (cfg *Config) Apply(root ast.Node, pre, post ApplyFunc) (result ast.Node) {
+	a := &applier{cfg: cfg, pre: pre, post: post, root: root}
+	defer func() {
+		if r := recover(); r != nil && r != abort {
+			panic(r)
+		}
+		result = a.root
+	}()
+	a.apply(nil, root, componentId(nil, idComponent(root)))
+	return
+}
+
+// ReplaceAt replaces the node with the given ID in root with n and returns
+// the (possibly replaced) root. It returns an error if no node in root has
+// the ID.
+func ReplaceAt(root ast.Node, id NodeId, n ast.Node) (ast.Node, error) {
+	return defaultConfig.ReplaceAt(root, id, n)
+}
+
+// ReplaceAt is like the package-level ReplaceAt, computing IDs as configured
+// by cfg.
+func (cfg *Config) ReplaceAt(root ast.Node, id NodeId, n ast.Node) (ast.Node, error) {
+	target := id.String()
+	found := false
+	root = cfg.Apply(root, func(c *Cursor) bool {
+		if found {
+			return false
+		}
+		cid := c.Id()
+		if cid.String() == target {
+			c.Replace(n)
+			found = true
+			return false
+		}
+		return id.hasPrefix(cid)
+	}, nil)
+	if !found {
+		return root, fmt.Errorf("idast.ReplaceAt: no node with ID %s", target)
+	}
+	return root, nil
+}
+
+var abort = new(int) // singleton, to signal termination of Apply
+
+type applier struct {
+	cfg       *Config
+	pre, post ApplyFunc
+	root      ast.Node
+}
+
+// apply applies a to node, whose ID is id.
+func (a *applier) apply(parent, node ast.Node, id NodeId) {
+	c := &Cursor{applier: a, parent: parent, node: node, id: id}
+	if a.pre != nil && !a.pre(c) {
+		return
+	}
+	if c.node == nil {
+		return
+	}
+
+	if c.node == node {
+		// The walker knows which children to visit and what their IDs are,
+		// in the context of node's ID, so ask it for node's immediate
+		// children.
+		var children []NodeWithId
+		a.cfg.WalkAt(childCollector{node, &children}, node, id)
+		for _, child := range children {
+			if _, ok := locate(node, child.Node); ok {
+				a.apply(node, child.Node, child.Id)
+			}
+		}
+	} else {
+		// A replacement is identified as the walker would identify it.
+		base := id
+		if idComponent(node) != "" {
+			base = id[:len(id)-1]
+		}
+		id = componentId(base, childComponent(parent, c.node))
+	}
+
+	if a.post != nil {
+		c = &Cursor{applier: a, parent: parent, node: c.node, id: id}
+		if !a.post(c) {
+			panic(abort)
+		}
+	}
+}
+
+// componentId returns base followed by the component comp, if not empty.
+func componentId(base NodeId, comp string) NodeId {
+	id := make(NodeId, len(base), len(base)+1)
+	copy(id, base)
+	if comp != "" {
+		id.push(comp)
+	}
+	return id
+}
+
+// A childCollector is a Visitor that records the immediate children of
+// node, with their IDs, without descending further.
+type childCollector struct {
+	node     ast.Node
+	children *[]NodeWithId
+}
+
+func (cc childCollector) Visit(n ast.Node, id NodeId) Visitor {
+	if n == cc.node {
+		return cc
+	}
+	if n != nil {
+		*cc.children = append(*cc.children, NodeWithId{n, id.dup()})
+	}
+	return nil
+}
+
+// A Cursor describes a node encountered during Apply. Information about the
+// node and its parent is available from the Node, Id and Parent methods.
+// The Replace, Delete, InsertBefore and InsertAfter methods can be used to
+// change the AST without disrupting Apply.
+type Cursor struct {
+	applier *applier
+	parent  ast.Node
+	node    ast.Node
+	id      NodeId
+}
+
+// Node returns the current node.
+func (c *Cursor) Node() ast.Node { return c.node }
+
+// Parent returns the parent of the current node, or nil for the root.
+func (c *Cursor) Parent() ast.Node { return c.parent }
+
+// Id returns the ID of the current node.
+func (c *Cursor) Id() NodeId { return c.id }
+
+// Replace replaces the current node with n. The replacement node is not
+// walked by Apply.
+func (c *Cursor) Replace(n ast.Node) {
+	if c.parent == nil {
+		c.applier.root = n
+		c.node = n
+		return
+	}
+	s := c.slot()
+	v := reflect.ValueOf(n)
+	if n == nil {
+		v = reflect.Zero(s.typ())
+	} else if !v.Type().AssignableTo(s.typ()) {
+		panic(fmt.Sprintf("idast: cannot replace %T with %T in %T", c.node, n, c.parent))
+	}
+	s.set(v)
+	c.node = n
+}
+
+// Delete deletes the current node from its containing slice (or, for the
+// files of a package, map). Delete panics if the current node is not part of
+// a slice or map.
+func (c *Cursor) Delete() {
+	s := c.slot()
+	switch {
+	case s.index >= 0:
+		s.field.Set(reflect.AppendSlice(s.field.Slice(0, s.index), s.field.Slice(s.index+1, s.field.Len())))
+	case s.key.IsValid():
+		s.field.SetMapIndex(s.key, reflect.Value{})
+	default:
+		panic("idast: Delete node not contained in slice or map")
+	}
+	c.node = nil
+}
+
+// InsertAfter inserts n after the current node in its containing slice.
+// InsertAfter panics if the current node is not part of a slice. The new
+// node is not walked by Apply.
+func (c *Cursor) InsertAfter(n ast.Node) {
+	c.insert(n, 1)
+}
+
+// InsertBefore inserts n before the current node in its containing slice.
+// InsertBefore panics if the current node is not part of a slice. The new
+// node is not walked by Apply.
+func (c *Cursor) InsertBefore(n ast.Node) {
+	c.insert(n, 0)
+}
+
+func (c *Cursor) insert(n ast.Node, offset int) {
+	s := c.slot()
+	if s.index < 0 {
+		panic("idast: Insert node not contained in slice")
+	}
+	v := reflect.ValueOf(n)
+	if !v.Type().AssignableTo(s.typ()) {
+		panic(fmt.Sprintf("idast: cannot insert %T next to %T in %T", n, c.node, c.parent))
+	}
+	i := s.index + offset
+	l := reflect.Append(s.field, reflect.Zero(s.typ()))
+	reflect.Copy(l.Slice(i+1, l.Len()), l.Slice(i, l.Len()-1))
+	l.Index(i).Set(v)
+	s.field.Set(l)
+}
+
+func (c *Cursor) slot() slot {
+	if c.parent == nil {
+		panic("idast: root node has no containing field")
+	}
+	s, ok := locate(c.parent, c.node)
+	if !ok {
+		panic(fmt.Sprintf("idast: %T is no longer a child of %T", c.node, c.parent))
+	}
+	return s
+}
+
+// A slot is the place in its parent that holds a node: a field, an element
+// of a slice field (index >= 0), or a value of a map field (key is valid).
+type slot struct {
+	field reflect.Value
+	index int
+	key   reflect.Value
+}
+
+func (s slot) typ() reflect.Type {
+	if s.index >= 0 || s.key.IsValid() {
+		return s.field.Type().Elem()
+	}
+	return s.field.Type()
+}
+
+func (s slot) set(v reflect.Value) {
+	switch {
+	case s.index >= 0:
+		s.field.Index(s.index).Set(v)
+	case s.key.IsValid():
+		s.field.SetMapIndex(s.key, v)
+	default:
+		s.field.Set(v)
+	}
+}
+
+// locate finds the slot in parent that holds node.
+func locate(parent, node ast.Node) (slot, bool) {
+	p := reflect.ValueOf(parent).Elem()
+	for i := 0; i < p.NumField(); i++ {
+		if !p.Type().Field(i).IsExported() {
+			continue
+		}
+		f := p.Field(i)
+		switch f.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if !f.IsNil() && f.Interface() == node {
+				return slot{field: f, index: -1}, true
+			}
+		case reflect.Slice:
+			for j := 0; j < f.Len(); j++ {
+				if e := f.Index(j); (e.Kind() == reflect.Ptr || e.Kind() == reflect.Interface) && !e.IsNil() && e.Interface() == node {
+					return slot{field: f, index: j}, true
+				}
+			}
+		case reflect.Map:
+			for iter := f.MapRange(); iter.Next(); {
+				if iter.Value().Interface() == node {
+					return slot{field: f, index: -1, key: iter.Key()}, true
+				}
+			}
+		}
+	}
+	return slot{}, false
+}
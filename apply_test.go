@@ -0,0 +1,171 @@
+package idast
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+func parseApplySrc(t *testing.T) *ast.File {
+	src := "package p\nfunc A() {\n\ta()\n\tb()\n\tc()\n}\n"
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	return file
+}
+
+func TestApplyIds(t *testing.T) {
+	file := parseApplySrc(t)
+	want := Map(file)
+	n := 0
+	Apply(file, func(c *Cursor) bool {
+		n++
+		id, got := want[c.Node()], c.Id()
+		if id.String() != got.String() {
+			t.Errorf("%T: want ID %v, got %v", c.Node(), id.String(), got.String())
+		}
+		return true
+	}, nil)
+	if n != len(want) {
+		t.Errorf("want %d nodes visited, got %d", len(want), n)
+	}
+}
+
+func TestApplyFieldIds(t *testing.T) {
+	src := "package p\ntype T struct { A int; io.Reader; B, _ string }\ntype I interface { M(); fmt.Stringer }\n"
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	want := Map(file)
+	n := 0
+	Apply(file, func(c *Cursor) bool {
+		n++
+		id, got := want[c.Node()], c.Id()
+		if id.String() != got.String() {
+			t.Errorf("%T: want ID %v, got %v", c.Node(), id.String(), got.String())
+		}
+		return true
+	}, nil)
+	if n != len(want) {
+		t.Errorf("want %d nodes visited, got %d", len(want), n)
+	}
+
+	// Fields can be replaced by the IDs that Map gives them.
+	id := ParseNodeId("Decls/0/GenDecl/Specs/TypeSpec:T/Type/StructType/Fields/FieldList/List/A/Field/Type/Ident")
+	if _, err := ReplaceAt(file, id, ast.NewIdent("int64")); err != nil {
+		t.Errorf("ReplaceAt: %v", err)
+	}
+	wantSrc := "type T struct {\n\tA\tint64\n\tio.Reader\n\tB, _\tstring\n}"
+	if got := pretty(file.Decls[0]); got != wantSrc {
+		t.Errorf("want:\n%s\ngot:\n%s", wantSrc, got)
+	}
+}
+
+func TestApplySpecIds(t *testing.T) {
+	src := "package p\nimport (\n\t_ \"embed\"\n\t\"fmt\"\n\t_ \"embed\"\n)\n"
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	want := Map(file)
+	dup := file.Decls[0].(*ast.GenDecl).Specs[2]
+	var post []string
+	Apply(file, func(c *Cursor) bool {
+		id, got := want[c.Node()], c.Id()
+		if id.String() != got.String() {
+			t.Errorf("%T: want ID %v, got %v", c.Node(), id.String(), got.String())
+		}
+		if c.Node() == dup {
+			c.Replace(&ast.ImportSpec{Name: ast.NewIdent("_"), Path: &ast.BasicLit{Kind: token.STRING, Value: `"embed"`}})
+		}
+		return true
+	}, func(c *Cursor) bool {
+		if _, ok := c.Node().(*ast.ImportSpec); ok {
+			id := c.Id()
+			post = append(post, id.String())
+		}
+		return true
+	})
+	// The replacement of the second import of embed keeps its ordinal.
+	wantPost := []string{
+		`Decls/0/GenDecl/Specs/ImportSpec:"embed"`,
+		`Decls/0/GenDecl/Specs/ImportSpec:"fmt"`,
+		`Decls/0/GenDecl/Specs/ImportSpec:"embed":1`,
+	}
+	if !reflect.DeepEqual(post, wantPost) {
+		t.Errorf("want post IDs %v, got %v", wantPost, post)
+	}
+}
+
+func TestApplyEdits(t *testing.T) {
+	file := parseApplySrc(t)
+	call := func(name string) ast.Stmt {
+		return &ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent(name)}}
+	}
+	Apply(file, func(c *Cursor) bool {
+		switch id := c.Id(); id.String() {
+		case "Decls/0/FuncDecl:A/Body/BlockStmt/List/0/ExprStmt":
+			c.InsertBefore(call("before"))
+		case "Decls/0/FuncDecl:A/Body/BlockStmt/List/1/ExprStmt":
+			c.Delete()
+		case "Decls/0/FuncDecl:A/Body/BlockStmt/List/2/ExprStmt":
+			c.InsertAfter(call("after"))
+		}
+		return true
+	}, func(c *Cursor) bool {
+		if id, ok := c.Node().(*ast.Ident); ok && id.Name == "c" {
+			c.Replace(ast.NewIdent("z"))
+		}
+		return true
+	})
+
+	want := "func A() {\n\tbefore()\n\ta()\n\tz()\n\tafter()\n}"
+	if got := pretty(file.Decls[0]); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestApplyAbort(t *testing.T) {
+	file := parseApplySrc(t)
+	n := 0
+	Apply(file, nil, func(c *Cursor) bool {
+		n++
+		_, ok := c.Node().(*ast.ExprStmt)
+		return !ok
+	})
+	// The package name, A's name, params and type, then a, a() and its
+	// statement.
+	if n != 7 {
+		t.Errorf("want traversal to stop after 7 nodes, got %d", n)
+	}
+}
+
+func TestReplaceAt(t *testing.T) {
+	file := parseApplySrc(t)
+	id := ParseNodeId("Decls/0/FuncDecl:A/Body/BlockStmt/List/1/ExprStmt/X/CallExpr/Fun/Ident")
+	root, err := ReplaceAt(file, id, ast.NewIdent("y"))
+	if err != nil {
+		t.Fatalf("ReplaceAt: %v", err)
+	}
+	if root != file {
+		t.Errorf("want root unchanged")
+	}
+	want := "func A() {\n\ta()\n\ty()\n\tc()\n}"
+	if got := pretty(file.Decls[0]); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+
+	if _, err := ReplaceAt(file, ParseNodeId("Decls/9/FuncDecl:A"), ast.NewIdent("y")); err == nil {
+		t.Errorf("want error replacing at an unknown ID")
+	}
+
+	x, _ := parser.ParseExpr("a + b")
+	y := ast.NewIdent("y")
+	if root, err := ReplaceAt(x, NodeId{"BinaryExpr"}, y); err != nil || root != y {
+		t.Errorf("want root replaced, got %v, %v", root, err)
+	}
+}
@@ -0,0 +1,37 @@
+// Command idast-lsp is a Language Server Protocol server, speaking on stdin
+// and stdout, that shows and resolves the IDs of the nodes in Go files:
+//
+//   - hovering over a node shows its ID;
+//   - a code action copies the ID of the node at the cursor (via the
+//     idast.copyId command, which returns it);
+//   - workspace/symbol finds the nodes whose IDs match a pattern, such as
+//     **/FuncDecl:Test*, in the open documents and the workspace;
+//   - the idast.goToId command, with a document URI and an ID, shows the
+//     node with that ID.
+//
+// IDs are relative to each file. Files are parsed in-process; nothing is
+// type-checked or loaded from the network. Files in the workspace are parsed
+// again only when their size or modification time changes, or the client
+// reports a change with workspace/didChangeWatchedFiles.
+package main
+
+import (
+	"log"
+	"os"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("idast-lsp: ")
+	s := newServer(os.Stdout)
+	err := s.serve(os.Stdin)
+	if err == errExit {
+		if s.shutdown {
+			os.Exit(0)
+		}
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
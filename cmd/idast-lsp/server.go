@@ -0,0 +1,489 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sourcegraph/go-idast"
+)
+
+// maxSymbols is the most results returned for a workspace/symbol request.
+const maxSymbols = 1000
+
+// errExit is returned by serve when the client sends the exit notification.
+var errExit = errors.New("exit")
+
+// A server answers LSP requests about the IDs of the nodes in Go files. IDs
+// are relative to each file, as computed by idast.Map.
+type server struct {
+	out      io.Writer
+	root     string                 // workspace root directory, if any
+	docs     map[string]string      // text of open documents, by URI
+	parsed   map[string]*parsedFile // by URI, of open documents and files on disk
+	nextID   int                    // of requests to the client
+	shutdown bool
+
+	hook func(method string) // if set, called before handling each request; for tests
+}
+
+type parsedFile struct {
+	text string
+	tf   *token.File
+	file *ast.File
+
+	// modTime and size are those of the file on disk, if it was read from
+	// there rather than from an open document.
+	modTime time.Time
+	size    int64
+}
+
+func newServer(out io.Writer) *server {
+	return &server{out: out, docs: make(map[string]string), parsed: make(map[string]*parsedFile)}
+}
+
+// serve reads and handles messages from in until it is exhausted or the
+// client sends the exit notification.
+func (s *server) serve(in io.Reader) error {
+	r := bufio.NewReader(in)
+	for {
+		m, err := readMessage(r)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if m.Method == "" {
+			continue // a response to a request of ours
+		}
+		if m.ID == nil {
+			if err := s.notify(m.Method, m.Params); err != nil {
+				return err
+			}
+			continue
+		}
+
+		resp := &message{ID: m.ID}
+		result, err := s.handle(m.Method, m.Params)
+		if err == nil {
+			resp.Result, err = json.Marshal(result)
+		}
+		if err != nil {
+			rerr, ok := err.(*responseError)
+			if !ok {
+				rerr = &responseError{codeInternalError, err.Error()}
+			}
+			resp.Result, resp.Error = nil, rerr
+		}
+		if err := writeMessage(s.out, resp); err != nil {
+			return err
+		}
+	}
+}
+
+// notify handles a notification from the client.
+func (s *server) notify(method string, params json.RawMessage) error {
+	switch method {
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return err
+		}
+		s.docs[p.TextDocument.URI] = p.TextDocument.Text
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return err
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			s.docs[p.TextDocument.URI] = p.ContentChanges[n-1].Text
+		}
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		delete(s.parsed, p.TextDocument.URI)
+	case "workspace/didChangeWatchedFiles":
+		var p didChangeWatchedFilesParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return err
+		}
+		for _, c := range p.Changes {
+			delete(s.parsed, c.URI)
+		}
+	case "exit":
+		return errExit
+	}
+	return nil
+}
+
+// handle returns the result of a request from the client. A panic while
+// handling the request is returned as an internal error, so that one bad
+// file or request does not take down the server.
+func (s *server) handle(method string, params json.RawMessage) (result interface{}, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			result, err = nil, &responseError{codeInternalError, fmt.Sprintf("%s: %v", method, e)}
+		}
+	}()
+	if s.hook != nil {
+		s.hook(method)
+	}
+	switch method {
+	case "initialize":
+		var p initializeParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &responseError{codeInvalidParams, err.Error()}
+		}
+		if p.RootURI != "" {
+			root, err := uriPath(p.RootURI)
+			if err != nil {
+				return nil, &responseError{codeInvalidParams, err.Error()}
+			}
+			s.root = root
+		}
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":        1, // full
+				"hoverProvider":           true,
+				"codeActionProvider":      true,
+				"workspaceSymbolProvider": true,
+				"executeCommandProvider": map[string]interface{}{
+					"commands": []string{"idast.copyId", "idast.goToId"},
+				},
+			},
+			"serverInfo": map[string]string{"name": "idast-lsp"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/hover":
+		var p textDocumentPositionParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &responseError{codeInvalidParams, err.Error()}
+		}
+		return s.hover(p)
+	case "textDocument/codeAction":
+		var p codeActionParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &responseError{codeInvalidParams, err.Error()}
+		}
+		return s.codeActions(p)
+	case "workspace/symbol":
+		var p workspaceSymbolParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &responseError{codeInvalidParams, err.Error()}
+		}
+		return s.symbols(p.Query)
+	case "workspace/executeCommand":
+		var p executeCommandParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &responseError{codeInvalidParams, err.Error()}
+		}
+		return s.executeCommand(p)
+	}
+	return nil, &responseError{codeMethodNotFound, "method not supported: " + method}
+}
+
+// hover shows the ID of the innermost node at the position.
+func (s *server) hover(p textDocumentPositionParams) (*hover, error) {
+	n, id, f, err := s.at(p.TextDocument.URI, p.Position)
+	if err != nil || n == nil {
+		return nil, err
+	}
+	return &hover{
+		Contents: markupContent{Kind: "markdown", Value: "```text\n" + id.String() + "\n```"},
+		Range:    f.rangeOf(n),
+	}, nil
+}
+
+// codeActions offers to copy the ID of the innermost node at the start of
+// the range.
+func (s *server) codeActions(p codeActionParams) ([]codeAction, error) {
+	n, id, _, err := s.at(p.TextDocument.URI, p.Range.Start)
+	if err != nil || n == nil {
+		return []codeAction{}, err
+	}
+	title := "Copy ID " + id.String()
+	return []codeAction{{
+		Title:   title,
+		Kind:    "source",
+		Command: command{Title: title, Command: "idast.copyId", Arguments: []interface{}{id.String()}},
+	}}, nil
+}
+
+// executeCommand runs one of the commands offered by the server:
+//
+//	idast.copyId <id>        shows the ID, and returns it for the client to copy
+//	idast.goToId <uri> <id>  shows the node with the ID, and returns its location
+func (s *server) executeCommand(p executeCommandParams) (interface{}, error) {
+	args := make([]string, len(p.Arguments))
+	for i, a := range p.Arguments {
+		if err := json.Unmarshal(a, &args[i]); err != nil {
+			return nil, &responseError{codeInvalidParams, "arguments must be strings"}
+		}
+	}
+	switch p.Command {
+	case "idast.copyId":
+		if len(args) != 1 {
+			return nil, &responseError{codeInvalidParams, "usage: idast.copyId <id>"}
+		}
+		err := s.send("window/showMessage", map[string]interface{}{"type": messageInfo, "message": args[0]})
+		return args[0], err
+	case "idast.goToId":
+		if len(args) != 2 {
+			return nil, &responseError{codeInvalidParams, "usage: idast.goToId <uri> <id>"}
+		}
+		f, err := s.parse(args[0])
+		if err != nil {
+			return nil, err
+		}
+		n := idast.Find(f.file, idast.ParseNodeId(args[1]))
+		if n == nil {
+			return nil, &responseError{codeInvalidParams, "no node with ID " + args[1]}
+		}
+		loc := location{URI: args[0], Range: f.rangeOf(n)}
+		s.nextID++
+		err = s.request(s.nextID, "window/showDocument", map[string]interface{}{
+			"uri": loc.URI, "takeFocus": true, "selection": loc.Range,
+		})
+		return loc, err
+	}
+	return nil, &responseError{codeInvalidParams, "unknown command: " + p.Command}
+}
+
+// symbols returns the nodes whose IDs match query, an idast.Pattern, in the
+// open documents and the Go files under the workspace root.
+func (s *server) symbols(query string) ([]symbolInformation, error) {
+	syms := []symbolInformation{}
+	if query == "" {
+		return syms, nil
+	}
+	pat, err := idast.CompilePattern(query)
+	if err != nil {
+		return nil, &responseError{codeInvalidParams, err.Error()}
+	}
+
+	uris := make(map[string]bool)
+	for uri := range s.docs {
+		uris[uri] = true
+	}
+	if s.root != "" {
+		err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				name := d.Name()
+				if p != s.root && (name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(p, ".go") {
+				uris[pathURI(p)] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for uri := range s.parsed {
+			if !uris[uri] {
+				delete(s.parsed, uri) // removed from the workspace
+			}
+		}
+	}
+	var sorted []string
+	for uri := range uris {
+		sorted = append(sorted, uri)
+	}
+	sort.Strings(sorted)
+
+	for _, uri := range sorted {
+		f, err := s.parse(uri)
+		if err != nil {
+			continue
+		}
+		var found []symbolInformation
+		var offsets []int
+		for n, id := range idast.Map(f.file) {
+			if len(id) == 0 || !pat.Match(id) {
+				continue
+			}
+			found = append(found, symbolInformation{Name: id.String(), Kind: symbolKind(n), Location: location{URI: uri, Range: f.rangeOf(n)}})
+			offsets = append(offsets, f.tf.Offset(n.Pos()))
+		}
+		sort.Sort(byOffset{found, offsets})
+		syms = append(syms, found...)
+		if len(syms) >= maxSymbols {
+			return syms[:maxSymbols], nil
+		}
+	}
+	return syms, nil
+}
+
+type byOffset struct {
+	syms    []symbolInformation
+	offsets []int
+}
+
+func (b byOffset) Len() int { return len(b.syms) }
+func (b byOffset) Less(i, j int) bool {
+	if b.offsets[i] != b.offsets[j] {
+		return b.offsets[i] < b.offsets[j]
+	}
+	return b.syms[i].Name < b.syms[j].Name
+}
+func (b byOffset) Swap(i, j int) {
+	b.syms[i], b.syms[j] = b.syms[j], b.syms[i]
+	b.offsets[i], b.offsets[j] = b.offsets[j], b.offsets[i]
+}
+
+// symbolKind returns the LSP symbol kind of n.
+func symbolKind(n ast.Node) int {
+	switch n := n.(type) {
+	case *ast.FuncDecl:
+		if n.Recv != nil {
+			return symbolMethod
+		}
+		return symbolFunction
+	case *ast.TypeSpec:
+		switch n.Type.(type) {
+		case *ast.StructType:
+			return symbolStruct
+		case *ast.InterfaceType:
+			return symbolInterface
+		}
+		return symbolClass
+	case *ast.ValueSpec:
+		if obj := n.Names[0].Obj; obj != nil && obj.Kind == ast.Con {
+			return symbolConstant
+		}
+		return symbolVariable
+	case *ast.Field:
+		return symbolField
+	}
+	return symbolObject
+}
+
+// at returns the innermost node at p in the document, and its ID. The node
+// is nil if there is none other than the file itself.
+func (s *server) at(uri string, p position) (ast.Node, idast.NodeId, *parsedFile, error) {
+	f, err := s.parse(uri)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	offset, err := offsetOf(f.text, p)
+	if err != nil {
+		return nil, nil, nil, &responseError{codeInvalidParams, err.Error()}
+	}
+	n, id := idast.At(f.file, f.tf.Pos(offset))
+	if len(id) == 0 {
+		return nil, nil, f, nil
+	}
+	return n, id, f, nil
+}
+
+// parse returns the parsed document, which is read from disk unless it is
+// open. A document with syntax errors is parsed as far as possible. A file
+// read from disk is parsed again only once its modification time or size
+// changes, or the client reports that it changed.
+func (s *server) parse(uri string) (*parsedFile, error) {
+	text, open := s.docs[uri]
+	filename, err := uriPath(uri)
+	if err != nil {
+		return nil, &responseError{codeInvalidParams, err.Error()}
+	}
+	var info fs.FileInfo
+	if !open {
+		info, err = os.Stat(filename)
+		if err != nil {
+			delete(s.parsed, uri)
+			return nil, err
+		}
+		f, ok := s.parsed[uri]
+		if ok && !f.modTime.IsZero() && f.modTime.Equal(info.ModTime()) && f.size == info.Size() {
+			return f, nil
+		}
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	} else if f, ok := s.parsed[uri]; ok && f.text == text {
+		return f, nil
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, text, parser.ParseComments)
+	if file == nil {
+		return nil, err
+	}
+	f := &parsedFile{text: text, tf: fset.File(file.Pos()), file: file}
+	if info != nil {
+		f.modTime, f.size = info.ModTime(), info.Size()
+	}
+	s.parsed[uri] = f
+	return f, nil
+}
+
+func (f *parsedFile) rangeOf(n ast.Node) lspRange {
+	return lspRange{
+		Start: positionOf(f.text, f.tf.Offset(n.Pos())),
+		End:   positionOf(f.text, f.tf.Offset(n.End())),
+	}
+}
+
+// send sends a notification to the client.
+func (s *server) send(method string, params interface{}) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.out, &message{Method: method, Params: b})
+}
+
+// request sends a request to the client, whose response is ignored.
+func (s *server) request(id int, method string, params interface{}) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	raw := json.RawMessage(fmt.Sprint(id))
+	return writeMessage(s.out, &message{ID: &raw, Method: method, Params: b})
+}
+
+// uriPath returns the file path of a file URI.
+func uriPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("not a file URI: %s", uri)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+// pathURI returns the file URI of the path p.
+func pathURI(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(p)}).String()
+}
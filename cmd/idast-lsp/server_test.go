@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("package p\n\nfunc A() {}\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	rootURI := pathURI(dir)
+	bURI := pathURI(filepath.Join(dir, "b.go")) // open, but not saved
+
+	var in bytes.Buffer
+	id := 0
+	call := func(method string, params interface{}) {
+		b, err := json.Marshal(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := &message{Method: method, Params: b}
+		if method != "textDocument/didOpen" && method != "exit" {
+			id++
+			raw := json.RawMessage(strconv.Itoa(id))
+			m.ID = &raw
+		}
+		writeMessage(&in, m)
+	}
+	doc := map[string]string{"uri": bURI}
+	call("initialize", map[string]string{"rootUri": rootURI})
+	call("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]string{"uri": bURI, "text": "package p\n\n// 😀\nfunc B() { A() }\n"}})
+	call("textDocument/hover", map[string]interface{}{"textDocument": doc, "position": position{3, 11}})
+	call("textDocument/codeAction", map[string]interface{}{"textDocument": doc, "range": lspRange{position{3, 5}, position{3, 5}}})
+	call("workspace/symbol", map[string]string{"query": "Decls/*/FuncDecl:*"})
+	call("workspace/executeCommand", map[string]interface{}{"command": "idast.goToId", "arguments": []string{bURI, "Decls/0/FuncDecl:B/Body/BlockStmt"}})
+	call("textDocument/definition", map[string]interface{}{"textDocument": doc, "position": position{3, 11}})
+	call("shutdown", nil)
+	call("exit", nil)
+
+	var out bytes.Buffer
+	s := newServer(&out)
+	if err := s.serve(&in); err != errExit {
+		t.Fatalf("want exit, got %v", err)
+	}
+	if !s.shutdown {
+		t.Errorf("want shutdown")
+	}
+
+	results := make(map[string]json.RawMessage)
+	errs := make(map[string]*responseError)
+	var notes []string
+	r := bufio.NewReader(&out)
+	for {
+		m, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		if m.Method != "" {
+			notes = append(notes, m.Method)
+			continue
+		}
+		results[string(*m.ID)], errs[string(*m.ID)] = m.Result, m.Error
+	}
+
+	check := func(id string, v, want interface{}) {
+		if errs[id] != nil {
+			t.Errorf("request %s: %v", id, errs[id])
+			return
+		}
+		if err := json.Unmarshal(results[id], v); err != nil {
+			t.Errorf("request %s: %v", id, err)
+			return
+		}
+		if got := reflect.ValueOf(v).Elem().Interface(); !reflect.DeepEqual(got, want) {
+			t.Errorf("request %s: want %+v, got %+v", id, want, got)
+		}
+	}
+	check("2", new(hover), hover{
+		Contents: markupContent{"markdown", "```text\nDecls/0/FuncDecl:B/Body/BlockStmt/List/0/ExprStmt/X/CallExpr/Fun/Ident\n```"},
+		Range:    lspRange{position{3, 11}, position{3, 12}},
+	})
+	check("3", new([]codeAction), []codeAction{{
+		Title: "Copy ID Decls/0/FuncDecl:B/Name/Ident",
+		Kind:  "source",
+		Command: command{
+			Title:     "Copy ID Decls/0/FuncDecl:B/Name/Ident",
+			Command:   "idast.copyId",
+			Arguments: []interface{}{"Decls/0/FuncDecl:B/Name/Ident"},
+		},
+	}})
+	check("4", new([]symbolInformation), []symbolInformation{
+		{"Decls/0/FuncDecl:A", symbolFunction, location{pathURI(filepath.Join(dir, "a.go")), lspRange{position{2, 0}, position{2, 11}}}},
+		{"Decls/0/FuncDecl:B", symbolFunction, location{bURI, lspRange{position{3, 0}, position{3, 16}}}},
+	})
+	check("5", new(location), location{bURI, lspRange{position{3, 9}, position{3, 16}}})
+	if errs["6"] == nil || errs["6"].Code != codeMethodNotFound {
+		t.Errorf("want method not found for textDocument/definition, got %v", errs["6"])
+	}
+	if want := []string{"window/showDocument"}; !reflect.DeepEqual(notes, want) {
+		t.Errorf("want messages to the client %v, got %v", want, notes)
+	}
+}
+
+// exchange sends the requests in calls to s, numbered from 1, and returns
+// the responses by request number.
+func exchange(t *testing.T, s *server, calls []*message) map[string]*message {
+	var in bytes.Buffer
+	for i, m := range calls {
+		if m.Method != "textDocument/didOpen" {
+			raw := json.RawMessage(strconv.Itoa(i + 1))
+			m.ID = &raw
+		}
+		writeMessage(&in, m)
+	}
+	var out bytes.Buffer
+	s.out = &out
+	if err := s.serve(&in); err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	resps := make(map[string]*message)
+	r := bufio.NewReader(&out)
+	for {
+		m, err := readMessage(r)
+		if err != nil {
+			return resps
+		}
+		if m.ID != nil {
+			resps[string(*m.ID)] = m
+		}
+	}
+}
+
+func newCall(t *testing.T, method string, params interface{}) *message {
+	b, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &message{Method: method, Params: b}
+}
+
+func TestServerGenerics(t *testing.T) {
+	dir := t.TempDir()
+	src := "package p\n\nfunc k(c chan int) { for range c {} }\n\ntype P[K comparable, V any] map[K]V\n\nvar x P[int, string]\n"
+	if err := os.WriteFile(filepath.Join(dir, "g.go"), []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	uri := pathURI(filepath.Join(dir, "k.go"))
+	doc := map[string]string{"uri": uri}
+	resps := exchange(t, newServer(nil), []*message{
+		newCall(t, "initialize", map[string]string{"rootUri": pathURI(dir)}),
+		newCall(t, "textDocument/didOpen", map[string]interface{}{"textDocument": map[string]string{"uri": uri, "text": "package p\n\nfunc k(c chan int) { for range c {} }\n"}}),
+		newCall(t, "textDocument/hover", map[string]interface{}{"textDocument": doc, "position": position{2, 34}}),
+		newCall(t, "workspace/symbol", map[string]string{"query": "**/TypeSpec:*"}),
+	})
+
+	var h hover
+	if m := resps["3"]; m == nil || m.Error != nil || json.Unmarshal(m.Result, &h) != nil {
+		t.Fatalf("hover: want result, got %+v", m)
+	}
+	if want := "```text\nDecls/0/FuncDecl:k/Body/BlockStmt/List/0/RangeStmt/Body/BlockStmt\n```"; h.Contents.Value != want {
+		t.Errorf("hover: want %q, got %q", want, h.Contents.Value)
+	}
+	var syms []symbolInformation
+	if m := resps["4"]; m == nil || m.Error != nil || json.Unmarshal(m.Result, &syms) != nil {
+		t.Fatalf("workspace/symbol: want result, got %+v", m)
+	}
+	if len(syms) != 1 || syms[0].Name != "Decls/1/GenDecl/Specs/TypeSpec:P" {
+		t.Errorf("workspace/symbol: want TypeSpec:P, got %+v", syms)
+	}
+}
+
+func TestServerPanic(t *testing.T) {
+	uri := pathURI(filepath.Join(t.TempDir(), "a.go"))
+	s := newServer(nil)
+	s.hook = func(method string) {
+		if method == "textDocument/hover" {
+			panic("hover")
+		}
+	}
+	resps := exchange(t, s, []*message{
+		newCall(t, "textDocument/didOpen", map[string]interface{}{"textDocument": map[string]string{"uri": uri, "text": "package p\n"}}),
+		newCall(t, "textDocument/hover", map[string]interface{}{"textDocument": map[string]string{"uri": uri}, "position": position{0, 0}}),
+		newCall(t, "shutdown", nil),
+	})
+	if m := resps["2"]; m == nil || m.Error == nil || m.Error.Code != codeInternalError {
+		t.Errorf("want internal error for a panicking request, got %+v", m)
+	}
+	if m := resps["3"]; m == nil || m.Error != nil {
+		t.Errorf("want the server to keep serving, got %+v", m)
+	}
+}
+
+func TestServerSymbolCache(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "a.go")
+	uri := pathURI(filename)
+	if err := os.WriteFile(filename, []byte("package p\n\nfunc A() {}\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(nil)
+	names := func() []string {
+		t.Helper()
+		resps := exchange(t, s, []*message{
+			newCall(t, "initialize", map[string]string{"rootUri": pathURI(dir)}),
+			newCall(t, "workspace/symbol", map[string]string{"query": "**/FuncDecl:*"}),
+		})
+		var syms []symbolInformation
+		if m := resps["2"]; m == nil || m.Error != nil || json.Unmarshal(m.Result, &syms) != nil {
+			t.Fatalf("workspace/symbol: want result, got %+v", m)
+		}
+		var names []string
+		for _, sym := range syms {
+			names = append(names, sym.Name)
+		}
+		return names
+	}
+
+	if got, want := names(), []string{"Decls/0/FuncDecl:A"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	f := s.parsed[uri]
+	if f == nil {
+		t.Fatalf("want %s cached", uri)
+	}
+	names()
+	if s.parsed[uri] != f {
+		t.Errorf("want the cached file reused while it is unchanged")
+	}
+
+	// The same size and modification time, as for a quick edit on a
+	// filesystem with a coarse clock: only the notification tells.
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, []byte("package p\n\nfunc B() {}\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filename, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(), []string{"Decls/0/FuncDecl:A"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("before didChangeWatchedFiles: want %v, got %v", want, got)
+	}
+	params, _ := json.Marshal(map[string]interface{}{"changes": []map[string]interface{}{{"uri": uri, "type": 2}}})
+	if err := s.notify("workspace/didChangeWatchedFiles", params); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(), []string{"Decls/0/FuncDecl:B"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after didChangeWatchedFiles: want %v, got %v", want, got)
+	}
+
+	// A change of size is noticed without a notification.
+	if err := os.WriteFile(filename, []byte("package p\n\nfunc CD() {}\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(), []string{"Decls/0/FuncDecl:CD"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after a change of size: want %v, got %v", want, got)
+	}
+
+	if err := os.Remove(filename); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(); len(got) != 0 {
+		t.Errorf("after removal: want no symbols, got %v", got)
+	}
+	if _, ok := s.parsed[uri]; ok {
+		t.Errorf("want %s dropped from the cache after removal", uri)
+	}
+}
+
+func TestPositions(t *testing.T) {
+	text := "a\n😀b\n"
+	for offset, want := range map[int]position{0: {0, 0}, 2: {1, 0}, 6: {1, 2}, 8: {2, 0}} {
+		if got := positionOf(text, offset); got != want {
+			t.Errorf("positionOf(%d): want %v, got %v", offset, want, got)
+		}
+		if got, err := offsetOf(text, want); err != nil || got != offset {
+			t.Errorf("offsetOf(%v): want %d, got %d (%v)", want, offset, got, err)
+		}
+	}
+	if _, err := offsetOf(text, position{3, 0}); err == nil {
+		t.Errorf("offsetOf: want error beyond end of text")
+	}
+}
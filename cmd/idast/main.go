@@ -0,0 +1,54 @@
+// Command idast works with the IDs of the nodes in Go files.
+//
+// Usage:
+//
+//	idast serve [-addr localhost:7080]
+//
+// The serve subcommand answers HTTP requests about IDs, for tools that can't
+// link the Go library:
+//
+//	GET  /ids?file=F              the IDs of all nodes in file F
+//	GET  /resolve?file=F&id=ID    the node with the given ID
+//	GET  /at?file=F&offset=N      the innermost node at byte offset N
+//	GET  /diff?old=F&new=G        the IDs added, removed and changed from F to G
+//	POST /diff                    likewise, for a JSON body {"old": src, "new": src}
+//
+// Responses are JSON. Nodes are reported as objects with "id", "kind",
+// "start" and "end" fields, the last two giving the offset, line and column
+// of the node's extent. IDs are relative to each file. Parsed files are
+// cached, and parsed again when their modification time or size changes;
+// the least recently used are dropped when the cache is full. Requests
+// whose Host or Origin header is not localhost, 127.0.0.1 or ::1 are
+// refused, so that web pages cannot use the server to read local files.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: idast serve [-addr localhost:7080]")
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("idast: ")
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "serve":
+		fs := flag.NewFlagSet("serve", flag.ExitOnError)
+		addr := fs.String("addr", "localhost:7080", "address to listen on")
+		fs.Parse(os.Args[2:])
+		log.Printf("listening on http://%s", *addr)
+		log.Fatal(http.ListenAndServe(*addr, newServer()))
+	default:
+		usage()
+	}
+}
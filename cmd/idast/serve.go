@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sourcegraph/go-idast"
+)
+
+// maxCached is the most parsed files the server keeps.
+const maxCached = 256
+
+// A server answers HTTP requests about the IDs of the nodes in Go files.
+type server struct {
+	mux *http.ServeMux
+
+	mu    sync.Mutex
+	cache map[string]*parsedFile // by absolute path
+	uses  int                    // counts cache lookups, for lastUse
+}
+
+// A parsedFile is a parsed Go file, with the IDs of its nodes in walk order.
+type parsedFile struct {
+	modTime time.Time
+	size    int64
+	lastUse int
+
+	src   []byte
+	tf    *token.File
+	file  *ast.File
+	nodes []idast.NodeWithId
+}
+
+func newServer() *server {
+	s := &server{mux: http.NewServeMux(), cache: make(map[string]*parsedFile)}
+	s.mux.HandleFunc("/ids", s.serveIds)
+	s.mux.HandleFunc("/resolve", s.serveResolve)
+	s.mux.HandleFunc("/at", s.serveAt)
+	s.mux.HandleFunc("/diff", s.serveDiff)
+	return s
+}
+
+// ServeHTTP serves r if it comes from the local machine. The server reads
+// any file it is asked about, so requests whose Host or Origin is not local,
+// as from a web page using DNS rebinding, are refused.
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isLocal(r.Host) {
+		writeError(w, &httpError{http.StatusForbidden, "host not allowed: " + r.Host})
+		return
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !isLocal(u.Host) {
+			writeError(w, &httpError{http.StatusForbidden, "origin not allowed: " + origin})
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// isLocal reports whether host, with an optional port, names the local
+// machine.
+func isLocal(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	switch strings.Trim(host, "[]") {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+type nodeJSON struct {
+	ID    string       `json:"id"`
+	Kind  string       `json:"kind"`
+	Start positionJSON `json:"start"`
+	End   positionJSON `json:"end"`
+}
+
+type positionJSON struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type diffJSON struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// An httpError is an error with an HTTP status code.
+type httpError struct {
+	code int
+	msg  string
+}
+
+func (e *httpError) Error() string { return e.msg }
+
+func (s *server) serveIds(w http.ResponseWriter, r *http.Request) {
+	f, err := s.file(r.FormValue("file"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	nodes := []nodeJSON{}
+	for _, n := range f.nodes {
+		nodes = append(nodes, f.node(n))
+	}
+	writeJSON(w, nodes)
+}
+
+func (s *server) serveResolve(w http.ResponseWriter, r *http.Request) {
+	f, err := s.file(r.FormValue("file"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	id := r.FormValue("id")
+	for _, n := range f.nodes {
+		if n.Id.String() == id {
+			writeJSON(w, f.node(n))
+			return
+		}
+	}
+	writeError(w, &httpError{http.StatusNotFound, "no node with ID " + id})
+}
+
+func (s *server) serveAt(w http.ResponseWriter, r *http.Request) {
+	f, err := s.file(r.FormValue("file"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	offset, err := strconv.Atoi(r.FormValue("offset"))
+	if err != nil || offset < 0 || offset > len(f.src) {
+		writeError(w, &httpError{http.StatusBadRequest, "bad offset: " + r.FormValue("offset")})
+		return
+	}
+	n, id := idast.At(f.file, f.tf.Pos(offset))
+	if len(id) == 0 {
+		writeError(w, &httpError{http.StatusNotFound, "no node at offset " + strconv.Itoa(offset)})
+		return
+	}
+	writeJSON(w, f.node(idast.NodeWithId{Node: n, Id: id}))
+}
+
+func (s *server) serveDiff(w http.ResponseWriter, r *http.Request) {
+	var from, to *parsedFile
+	var err error
+	if r.Method == http.MethodPost {
+		var body struct{ Old, New string }
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, &httpError{http.StatusBadRequest, err.Error()})
+			return
+		}
+		if from, err = parse("old.go", []byte(body.Old)); err == nil {
+			to, err = parse("new.go", []byte(body.New))
+		}
+		if err != nil {
+			err = &httpError{http.StatusBadRequest, err.Error()}
+		}
+	} else {
+		if from, err = s.file(r.FormValue("old")); err == nil {
+			to, err = s.file(r.FormValue("new"))
+		}
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, diff(from, to))
+}
+
+// diff returns the IDs in to but not in from, in from but not in to, and in
+// both but with different source text, ignoring layout and comments.
+func diff(from, to *parsedFile) diffJSON {
+	d := diffJSON{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	fromText := make(map[string]string)
+	for _, n := range from.nodes {
+		if len(n.Id) > 0 {
+			fromText[n.Id.String()] = text(n.Node)
+		}
+	}
+	for _, n := range to.nodes {
+		if len(n.Id) == 0 {
+			continue
+		}
+		id := n.Id.String()
+		t, ok := fromText[id]
+		if !ok {
+			d.Added = append(d.Added, id)
+		} else if t != text(n.Node) {
+			d.Changed = append(d.Changed, id)
+		}
+		delete(fromText, id)
+	}
+	for id := range fromText {
+		d.Removed = append(d.Removed, id)
+	}
+	sort.Strings(d.Removed)
+	return d
+}
+
+var emptyFileSet = token.NewFileSet()
+
+// text returns the source of n, printed without its original layout or
+// comments.
+func text(n ast.Node) string {
+	var b bytes.Buffer
+	printer.Fprint(&b, emptyFileSet, n)
+	return b.String()
+}
+
+// file returns the named file, parsing it again if it has changed since it
+// was cached.
+func (s *server) file(name string) (*parsedFile, error) {
+	if name == "" {
+		return nil, &httpError{http.StatusBadRequest, "missing file"}
+	}
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, &httpError{http.StatusNotFound, err.Error()}
+	} else if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	f, ok := s.cache[path]
+	if ok && f.modTime.Equal(fi.ModTime()) && f.size == fi.Size() {
+		s.uses++
+		f.lastUse = s.uses
+		s.mu.Unlock()
+		return f, nil
+	}
+	s.mu.Unlock()
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if f, err = parse(path, src); err != nil {
+		return nil, &httpError{http.StatusUnprocessableEntity, err.Error()}
+	}
+	f.modTime, f.size = fi.ModTime(), fi.Size()
+	s.mu.Lock()
+	if _, ok := s.cache[path]; !ok && len(s.cache) >= maxCached {
+		s.evict()
+	}
+	s.uses++
+	f.lastUse = s.uses
+	s.cache[path] = f
+	s.mu.Unlock()
+	return f, nil
+}
+
+// evict removes the least recently used file from the cache. s.mu must be
+// held.
+func (s *server) evict() {
+	var oldest string
+	for path, f := range s.cache {
+		if oldest == "" || f.lastUse < s.cache[oldest].lastUse {
+			oldest = path
+		}
+	}
+	delete(s.cache, oldest)
+}
+
+func parse(filename string, src []byte) (*parsedFile, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	f := &parsedFile{src: src, tf: fset.File(file.Pos()), file: file}
+	idast.Inspect(file, func(n ast.Node, id idast.NodeId) bool {
+		if n != nil {
+			f.nodes = append(f.nodes, idast.NodeWithId{Node: n, Id: append(idast.NodeId(nil), id...)})
+		}
+		return true
+	})
+	return f, nil
+}
+
+func (f *parsedFile) node(n idast.NodeWithId) nodeJSON {
+	return nodeJSON{
+		ID:    n.Id.String(),
+		Kind:  reflect.TypeOf(n.Node).Elem().Name(),
+		Start: f.position(n.Node.Pos()),
+		End:   f.position(n.Node.End()),
+	}
+}
+
+func (f *parsedFile) position(pos token.Pos) positionJSON {
+	p := f.tf.Position(pos)
+	return positionJSON{p.Offset, p.Line, p.Column}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if herr, ok := err.(*httpError); ok {
+		code = herr.code
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
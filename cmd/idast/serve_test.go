@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.go")
+	b := filepath.Join(dir, "b.go")
+	write := func(name, src string, mtime time.Time) {
+		if err := os.WriteFile(name, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t0 := time.Now().Add(-time.Hour)
+	write(a, "package p\n\nfunc A() { x() }\n", t0)
+	write(b, "package p\n\nfunc A() { y() }\n\nfunc B() {}\n", t0)
+
+	ts := httptest.NewServer(newServer())
+	defer ts.Close()
+	get := func(path string, query url.Values, want int, v interface{}) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path + "?" + query.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s?%s: want status %d, got %d", path, query.Encode(), want, resp.StatusCode)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Errorf("%s?%s: %v", path, query.Encode(), err)
+		}
+	}
+
+	var ids []nodeJSON
+	get("/ids", url.Values{"file": {a}}, http.StatusOK, &ids)
+	if len(ids) != 10 || ids[0].Kind != "File" || ids[2].ID != "Decls/0/FuncDecl:A" {
+		t.Errorf("/ids: got %+v", ids)
+	}
+
+	var n nodeJSON
+	get("/resolve", url.Values{"file": {a}, "id": {"Decls/0/FuncDecl:A/Body/BlockStmt"}}, http.StatusOK, &n)
+	want := nodeJSON{"Decls/0/FuncDecl:A/Body/BlockStmt", "BlockStmt", positionJSON{20, 3, 10}, positionJSON{27, 3, 17}}
+	if n != want {
+		t.Errorf("/resolve: want %+v, got %+v", want, n)
+	}
+
+	n = nodeJSON{}
+	get("/at", url.Values{"file": {a}, "offset": {"22"}}, http.StatusOK, &n)
+	if n.ID != "Decls/0/FuncDecl:A/Body/BlockStmt/List/0/ExprStmt/X/CallExpr/Fun/Ident" {
+		t.Errorf("/at: got %+v", n)
+	}
+
+	var d diffJSON
+	get("/diff", url.Values{"old": {a}, "new": {b}}, http.StatusOK, &d)
+	wantDiff := diffJSON{
+		Added: []string{
+			"Decls/1/FuncDecl:B",
+			"Decls/1/FuncDecl:B/Name/Ident",
+			"Decls/1/FuncDecl:B/Type/FuncType",
+			"Decls/1/FuncDecl:B/Type/FuncType/Params/FieldList",
+			"Decls/1/FuncDecl:B/Body/BlockStmt",
+		},
+		Removed: []string{},
+		Changed: []string{
+			"Decls/0/FuncDecl:A",
+			"Decls/0/FuncDecl:A/Body/BlockStmt",
+			"Decls/0/FuncDecl:A/Body/BlockStmt/List/0/ExprStmt",
+			"Decls/0/FuncDecl:A/Body/BlockStmt/List/0/ExprStmt/X/CallExpr",
+			"Decls/0/FuncDecl:A/Body/BlockStmt/List/0/ExprStmt/X/CallExpr/Fun/Ident",
+		},
+	}
+	if !reflect.DeepEqual(d, wantDiff) {
+		t.Errorf("/diff: want %+v, got %+v", wantDiff, d)
+	}
+
+	resp, err := http.Post(ts.URL+"/diff", "application/json", strings.NewReader(`{"old": "package p\nvar x = 1\n", "new": "package p\n"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = diffJSON{}
+	json.NewDecoder(resp.Body).Decode(&d)
+	resp.Body.Close()
+	if len(d.Removed) != 4 || d.Removed[0] != "Decls/0/GenDecl" {
+		t.Errorf("POST /diff: got %+v", d)
+	}
+
+	// The cached parse of a.go is replaced once it changes.
+	write(a, "package p\n\nfunc C() {}\n", t0.Add(time.Minute))
+	get("/resolve", url.Values{"file": {a}, "id": {"Decls/0/FuncDecl:C"}}, http.StatusOK, &n)
+
+	var e map[string]string
+	get("/resolve", url.Values{"file": {a}, "id": {"Decls/0/FuncDecl:A"}}, http.StatusNotFound, &e)
+	get("/at", url.Values{"file": {a}, "offset": {"x"}}, http.StatusBadRequest, &e)
+	get("/ids", url.Values{"file": {filepath.Join(dir, "missing.go")}}, http.StatusNotFound, &e)
+	if e["error"] == "" {
+		t.Errorf("want an error message, got %v", e)
+	}
+}
+
+func TestServeHost(t *testing.T) {
+	ts := httptest.NewServer(newServer())
+	defer ts.Close()
+	for _, test := range []struct {
+		host, origin string
+		want         int
+	}{
+		{"", "", http.StatusBadRequest}, // missing file
+		{"localhost:7080", "http://localhost:7080", http.StatusBadRequest},
+		{"attacker.example:7080", "", http.StatusForbidden},
+		{"", "http://attacker.example", http.StatusForbidden},
+	} {
+		req, err := http.NewRequest("GET", ts.URL+"/ids", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.host != "" {
+			req.Host = test.host
+		}
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.want {
+			t.Errorf("Host %q, Origin %q: want status %d, got %d", test.host, test.origin, test.want, resp.StatusCode)
+		}
+	}
+}
+
+func TestServeCache(t *testing.T) {
+	dir := t.TempDir()
+	s := newServer()
+	var first string
+	for i := 0; i <= maxCached; i++ {
+		name := filepath.Join(dir, "f"+strconv.Itoa(i)+".go")
+		if err := os.WriteFile(name, []byte("package p\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = name
+		} else if i == 2 {
+			// Use the first file again, so that the second is evicted.
+			if _, err := s.file(first); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := s.file(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.cache) != maxCached {
+		t.Errorf("want %d cached files, got %d", maxCached, len(s.cache))
+	}
+	if _, ok := s.cache[first]; !ok {
+		t.Errorf("want recently used %s cached", first)
+	}
+	if _, ok := s.cache[filepath.Join(dir, "f1.go")]; ok {
+		t.Errorf("want least recently used f1.go evicted")
+	}
+}
@@ -0,0 +1,54 @@
+package idast
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"hash/fnv"
+)
+
+// A Mode value is a set of flags (or 0). They control how IDs are computed.
+type Mode uint
+
+const (
+	// StmtHashes identifies the statements of a block or case body by a
+	// short hash of their normalized source, such as "List/h3fa2", instead
+	// of by their index, so that inserting or removing a statement does not
+	// renumber its siblings. Identical statements in the same list are told
+	// apart by an ordinal suffix: "h3fa2", "h3fa2:1", ...
+	StmtHashes Mode = 1 << iota
+
+	// FileConstraints appends each file's build constraint, as implied by
+	// its name and its //go:build line, to the file's ID component, as in
+	// "open_linux.go(linux)". Use Variants to group declarations across
+	// such files.
+	FileConstraints
+)
+
+// A Config controls how IDs are computed. The package-level functions use
+// the zero Config.
+type Config struct {
+	Mode Mode
+
+	// Pkg identifies the package being walked. InspectGlobal and MapGlobal
+	// qualify the IDs they compute with it, and Global qualifies IDs
+	// computed otherwise.
+	Pkg PkgPath
+}
+
+var defaultConfig Config
+
+// hashFileSet is empty, so that statements are printed without their
+// original positions (and thus layout) or comments.
+var hashFileSet = token.NewFileSet()
+
+// stmtHash returns the StmtHashes ID component for s.
+func stmtHash(s ast.Stmt) string {
+	var b bytes.Buffer
+	printer.Fprint(&b, hashFileSet, s)
+	h := fnv.New32a()
+	h.Write(b.Bytes())
+	return fmt.Sprintf("h%04x", h.Sum32()&0xffff)
+}
@@ -0,0 +1,124 @@
+package idast
+
+import (
+	"go/ast"
+	"go/build/constraint"
+	"path"
+	"strings"
+)
+
+// fileComponent returns the ID component for the file f named filename in a
+// package.
+func (cfg *Config) fileComponent(filename string, f *ast.File) string {
+	name := path.Base(filename)
+	if cfg.Mode&FileConstraints != 0 {
+		if x := fileConstraint(name, f); x != nil {
+			name += "(" + strings.Replace(x.String(), " ", "", -1) + ")"
+		}
+	}
+	return name
+}
+
+// fileConstraint returns the build constraint of the file f named name: the
+// GOOS and GOARCH implied by its name, and its //go:build (or, failing that,
+// +build) lines. It returns nil if the file is unconstrained.
+func fileConstraint(name string, f *ast.File) constraint.Expr {
+	var x constraint.Expr
+	and := func(y constraint.Expr) {
+		if x == nil {
+			x = y
+		} else {
+			x = &constraint.AndExpr{X: x, Y: y}
+		}
+	}
+
+	// As in go/build, name_$GOOS_$GOARCH.go, name_$GOOS.go and
+	// name_$GOARCH.go (each optionally followed by _test) are constrained.
+	parts := strings.Split(strings.TrimSuffix(name, ".go"), "_")
+	if n := len(parts); n > 0 && parts[n-1] == "test" {
+		parts = parts[:n-1]
+	}
+	if n := len(parts); n >= 3 && knownOS[parts[n-2]] && knownArch[parts[n-1]] {
+		and(&constraint.TagExpr{Tag: parts[n-2]})
+		and(&constraint.TagExpr{Tag: parts[n-1]})
+	} else if n >= 2 && (knownOS[parts[n-1]] || knownArch[parts[n-1]]) {
+		and(&constraint.TagExpr{Tag: parts[n-1]})
+	}
+
+	var goBuild, plusBuild []constraint.Expr
+	for _, g := range f.Comments {
+		if g.Pos() >= f.Package {
+			break
+		}
+		for _, c := range g.List {
+			switch {
+			case constraint.IsGoBuild(c.Text):
+				if y, err := constraint.Parse(c.Text); err == nil {
+					goBuild = append(goBuild, y)
+				}
+			case constraint.IsPlusBuild(c.Text):
+				if y, err := constraint.Parse(c.Text); err == nil {
+					plusBuild = append(plusBuild, y)
+				}
+			}
+		}
+	}
+	if goBuild == nil {
+		goBuild = plusBuild
+	}
+	for _, y := range goBuild {
+		and(y)
+	}
+	return x
+}
+
+// knownOS and knownArch are the GOOS and GOARCH values that go/build
+// recognizes in file names.
+var knownOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true,
+	"freebsd": true, "hurd": true, "illumos": true, "ios": true, "js": true,
+	"linux": true, "nacl": true, "netbsd": true, "openbsd": true,
+	"plan9": true, "solaris": true, "wasip1": true, "windows": true,
+	"zos": true,
+}
+
+var knownArch = map[string]bool{
+	"386": true, "amd64": true, "amd64p32": true, "arm": true,
+	"armbe": true, "arm64": true, "arm64be": true, "loong64": true,
+	"mips": true, "mipsle": true, "mips64": true, "mips64le": true,
+	"mips64p32": true, "mips64p32le": true, "ppc": true, "ppc64": true,
+	"ppc64le": true, "riscv": true, "riscv64": true, "s390": true,
+	"s390x": true, "sparc": true, "sparc64": true, "wasm": true,
+}
+
+// Variants groups the declarations of pkg by logical ID: the ID component of
+// the declaration, independent of which file declares it. Package-level
+// functions are keyed like "FuncDecl:open", methods like "FuncDecl:T.open",
+// and the specs of type, var and const declarations like "TypeSpec:T" and
+// "ValueSpec:x". Declarations of the same entity in files for different
+// build constraints, such as open_linux.go and open_windows.go, share a
+// logical ID, whose IDs (in no particular order) are the variants.
+func Variants(pkg *ast.Package) map[string][]NodeId {
+	return defaultConfig.Variants(pkg)
+}
+
+// Variants is like the package-level Variants, computing IDs as configured
+// by cfg. Use the FileConstraints mode to tell variants apart by constraint.
+func (cfg *Config) Variants(pkg *ast.Package) map[string][]NodeId {
+	m := make(map[string][]NodeId)
+	add := func(key string, id NodeId) {
+		m[key] = append(m[key], id.dup())
+	}
+	cfg.Inspect(pkg, func(n ast.Node, id NodeId) bool {
+		switch n := n.(type) {
+		case *ast.Package, *ast.File, *ast.GenDecl:
+			return true
+		case *ast.FuncDecl:
+			add(funcKey(n), id)
+		case *ast.TypeSpec, *ast.ValueSpec:
+			add(idComponent(n), id)
+		}
+		return false
+	})
+	return m
+}
@@ -0,0 +1,112 @@
+package idast
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// DOTOptions control what WriteDOT renders.
+type DOTOptions struct {
+	// Mode controls how IDs are computed.
+	Mode Mode
+
+	// Prefix, if not empty, limits the graph to the subtrees whose root IDs
+	// start with Prefix.
+	Prefix NodeId
+
+	// MaxDepth, if positive, limits the graph to nodes at most MaxDepth
+	// levels below the root of each subtree.
+	MaxDepth int
+}
+
+// maxDOTSource is the number of characters of source text that WriteDOT
+// shows for each node.
+const maxDOTSource = 32
+
+// WriteDOT writes root to w as a Graphviz graph, in the DOT language. Each
+// node is labeled with its kind and the start of its source text, and has
+// its ID as a tooltip; each edge is labeled with the ID components that lead
+// from the parent to the child, such as "X", "Args/0" or "Body". Comments
+// are not shown. opts may be nil.
+func WriteDOT(w io.Writer, root ast.Node, opts *DOTOptions) error {
+	if opts == nil {
+		opts = &DOTOptions{}
+	}
+	cfg := &Config{Mode: opts.Mode}
+
+	type entry struct {
+		name  int // 0 if not shown
+		id    NodeId
+		in    bool // in a subtree selected by Prefix
+		depth int  // below the root of the subtree
+	}
+	var stack []entry
+	var nodes int
+	bw := bufio.NewWriter(w)
+	bw.WriteString("digraph AST {\n\tnode [shape=box, fontname=\"monospace\"];\n")
+	cfg.Walk(visitorFunc(func(n ast.Node, id NodeId) {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return
+		}
+		e := entry{id: id.dup(), in: id.hasPrefix(opts.Prefix)}
+		var parent entry
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+		}
+		if parent.in {
+			e.depth = parent.depth + 1
+		}
+		stack = append(stack, e)
+		switch n.(type) {
+		case *ast.Comment, *ast.CommentGroup:
+			return
+		}
+		if !e.in || (opts.MaxDepth > 0 && e.depth > opts.MaxDepth) {
+			return
+		}
+
+		nodes++
+		e.name = nodes
+		stack[len(stack)-1] = e
+		fmt.Fprintf(bw, "\tn%d [label=%s, tooltip=%s];\n", e.name, dotQuote(dotLabel(n)), dotQuote(id.String()))
+		if parent.name != 0 {
+			label := id[len(parent.id):]
+			if idComponent(n) != "" {
+				label = label[:len(label)-1]
+			}
+			fmt.Fprintf(bw, "\tn%d -> n%d [label=%s];\n", parent.name, e.name, dotQuote(strings.Join(label, "/")))
+		}
+	}), root)
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// dotLabel returns the kind of n and the start of its source text, on
+// separate lines.
+func dotLabel(n ast.Node) string {
+	kind := idComponent(n)
+	if kind == "" {
+		kind = reflect.TypeOf(n).Elem().Name()
+	}
+	var b bytes.Buffer
+	if err := printer.Fprint(&b, hashFileSet, n); err != nil {
+		return kind
+	}
+	src := []rune(strings.Join(strings.Fields(b.String()), " "))
+	if len(src) > maxDOTSource {
+		src = append(src[:maxDOTSource-3], []rune("...")...)
+	}
+	return kind + "\n" + string(src)
+}
+
+// dotQuote returns s as a quoted DOT string.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
@@ -0,0 +1,64 @@
+package idast
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestWriteDOT(t *testing.T) {
+	src := "package p\n\nfunc A() {\n\tf(\"x\", y+1)\n}\n"
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+
+	tests := []struct {
+		opts       *DOTOptions
+		want, omit []string
+	}{
+		{
+			opts: nil,
+			want: []string{
+				`n1 [label="File\npackage p func A() { f(\"x\", y...", tooltip=""];`,
+				`n3 [label="FuncDecl:A\nfunc A() { f(\"x\", y+1) }", tooltip="Decls/0/FuncDecl:A"];`,
+				`n1 -> n3 [label="Decls/0"];`,
+				`n8 -> n9 [label="X"];`,
+				`n9 -> n10 [label="Fun"];`,
+				`n9 -> n12 [label="Args/1"];`,
+				`n1 -> n2 [label="Name"];`,
+			},
+		},
+		{
+			opts: &DOTOptions{Prefix: NodeId{"Decls", "0", "FuncDecl:A", "Body"}, MaxDepth: 2},
+			want: []string{
+				`n1 [label="BlockStmt\n{ f(\"x\", y+1) }", tooltip="Decls/0/FuncDecl:A/Body/BlockStmt"];`,
+				`n1 -> n2 [label="List/0"];`,
+				`n2 -> n3 [label="X"];`,
+			},
+			omit: []string{`label="FuncDecl`, "n4", `label="File`},
+		},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		if err := WriteDOT(&b, file, test.opts); err != nil {
+			t.Fatalf("WriteDOT: %v", err)
+		}
+		got := b.String()
+		if !strings.HasPrefix(got, "digraph AST {\n") || !strings.HasSuffix(got, "}\n") {
+			t.Errorf("%+v: want a digraph, got:\n%s", test.opts, got)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%+v: want graph to contain %s\n\ngot:\n%s", test.opts, want, got)
+			}
+		}
+		for _, omit := range test.omit {
+			if strings.Contains(got, omit) {
+				t.Errorf("%+v: want graph not to contain %s\n\ngot:\n%s", test.opts, omit, got)
+			}
+		}
+	}
+}
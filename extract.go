@@ -0,0 +1,136 @@
+package idast
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"os"
+	"reflect"
+)
+
+// An ExtractConfig controls what Extract returns.
+type ExtractConfig struct {
+	// Mode controls how IDs are computed.
+	Mode Mode
+
+	// Doc includes the node's doc comment, if it has one.
+	Doc bool
+
+	// Context, if positive, makes Extract return the node's original source
+	// text, unformatted, with this many lines of surrounding context.
+	Context int
+
+	// Src is the source of the file containing the node, for Context. If
+	// nil, the file named in the FileSet is read.
+	Src []byte
+}
+
+// Extract returns the formatted source, including comments, of the node with
+// the given ID in root, which must be a file or package parsed (with
+// comments) into fset.
+func Extract(fset *token.FileSet, root ast.Node, id NodeId) (string, error) {
+	return (&ExtractConfig{}).Extract(fset, root, id)
+}
+
+// Extract is like the package-level Extract, as configured by cfg.
+func (cfg *ExtractConfig) Extract(fset *token.FileSet, root ast.Node, id NodeId) (string, error) {
+	n := (&Config{Mode: cfg.Mode}).Find(root, id)
+	if n == nil {
+		return "", fmt.Errorf("idast.Extract: no node with ID %s", id.String())
+	}
+
+	start := n.Pos()
+	doc := docOf(n)
+	if cfg.Doc && doc != nil {
+		start = doc.Pos()
+	} else if doc != nil {
+		n = withoutDoc(n)
+	}
+
+	if cfg.Context > 0 {
+		return cfg.context(fset, start, n.End())
+	}
+
+	var comments []*ast.CommentGroup
+	if f := enclosingFile(root, start); f != nil {
+		for _, g := range f.Comments {
+			if g.Pos() >= start && g.End() <= n.End() {
+				comments = append(comments, g)
+			}
+		}
+	}
+	var b bytes.Buffer
+	pc := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := pc.Fprint(&b, fset, &printer.CommentedNode{Node: n, Comments: comments}); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// context returns the source lines from start to end, with cfg.Context lines
+// before and after.
+func (cfg *ExtractConfig) context(fset *token.FileSet, start, end token.Pos) (string, error) {
+	tf := fset.File(start)
+	if tf == nil {
+		return "", errors.New("idast.Extract: node has no position information")
+	}
+	src := cfg.Src
+	if src == nil {
+		var err error
+		if src, err = os.ReadFile(tf.Name()); err != nil {
+			return "", err
+		}
+	}
+	if tf.Size() != len(src) {
+		return "", fmt.Errorf("idast.Extract: source of %s has changed since it was parsed", tf.Name())
+	}
+
+	first := tf.Line(start) - cfg.Context
+	if first < 1 {
+		first = 1
+	}
+	last := tf.Line(end) + cfg.Context
+	from := tf.Offset(tf.LineStart(first))
+	to := len(src)
+	if last < tf.LineCount() {
+		to = tf.Offset(tf.LineStart(last + 1))
+	}
+	return string(src[from:to]), nil
+}
+
+// docOf returns the doc comment of n, if n has one.
+func docOf(n ast.Node) *ast.CommentGroup {
+	if f := reflect.ValueOf(n).Elem().FieldByName("Doc"); f.IsValid() {
+		doc, _ := f.Interface().(*ast.CommentGroup)
+		return doc
+	}
+	return nil
+}
+
+// withoutDoc returns a shallow copy of n without its doc comment.
+func withoutDoc(n ast.Node) ast.Node {
+	v := reflect.ValueOf(n).Elem()
+	c := reflect.New(v.Type())
+	c.Elem().Set(v)
+	f := c.Elem().FieldByName("Doc")
+	f.Set(reflect.Zero(f.Type()))
+	return c.Interface().(ast.Node)
+}
+
+// enclosingFile returns the file in root that contains pos.
+func enclosingFile(root ast.Node, pos token.Pos) *ast.File {
+	switch r := root.(type) {
+	case *ast.File:
+		return r
+	case *ast.Package:
+		for _, f := range r.Files {
+			if f.FileStart <= pos && pos <= f.FileEnd {
+				return f
+			}
+		}
+	}
+	return nil
+}
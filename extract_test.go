@@ -0,0 +1,60 @@
+package idast
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "testdata/print.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("Error parsing testdata/print.go: %v", err)
+	}
+	id := ParseNodeId("Decls/17/FuncDecl:newPrinter")
+
+	tests := []struct {
+		cfg  ExtractConfig
+		id   NodeId
+		want string
+	}{
+		{
+			ExtractConfig{}, id,
+			"func newPrinter() *pp {\n\tp := ppFree.get().(*pp)\n\tp.panicking = false\n\tp.erroring = false\n\tp.fmt.init(&p.buf)\n\treturn p\n}",
+		},
+		{
+			ExtractConfig{Doc: true}, id,
+			"// newPrinter allocates a new pp struct or grab a cached one.\nfunc newPrinter() *pp {\n\tp := ppFree.get().(*pp)\n\tp.panicking = false\n\tp.erroring = false\n\tp.fmt.init(&p.buf)\n\treturn p\n}",
+		},
+		{
+			ExtractConfig{}, append(id.dup(), "Body", "BlockStmt", "List", "4", "ReturnStmt"),
+			"return p",
+		},
+		{
+			ExtractConfig{Doc: true, Context: 1}, id,
+			"\n// newPrinter allocates a new pp struct or grab a cached one.\nfunc newPrinter() *pp {\n\tp := ppFree.get().(*pp)\n\tp.panicking = false\n\tp.erroring = false\n\tp.fmt.init(&p.buf)\n\treturn p\n}\n\n",
+		},
+		{
+			ExtractConfig{Context: 1}, append(id.dup(), "Body", "BlockStmt", "List", "4", "ReturnStmt"),
+			"\tp.fmt.init(&p.buf)\n\treturn p\n}\n",
+		},
+	}
+	for _, test := range tests {
+		got, err := test.cfg.Extract(fset, file, test.id)
+		if err != nil {
+			t.Errorf("Extract(%v): %v", test.id.String(), err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Extract(%v) with %+v: want:\n%s\ngot:\n%s", test.id.String(), test.cfg, test.want, got)
+		}
+	}
+
+	if _, err := Extract(fset, file, ParseNodeId("Decls/99/FuncDecl:nope")); err == nil {
+		t.Errorf("want error extracting an unknown ID")
+	}
+	if _, err := (&ExtractConfig{Context: 1, Src: []byte("package fmt\n")}).Extract(fset, file, id); err == nil {
+		t.Errorf("want error extracting context from stale source")
+	}
+}
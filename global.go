@@ -0,0 +1,97 @@
+package idast
+
+import (
+	"errors"
+	"go/ast"
+	"strings"
+)
+
+// A PkgPath identifies the package that IDs belong to: its import path and,
+// optionally, the module (and module version) that provides it.
+type PkgPath struct {
+	Module     string
+	Version    string
+	ImportPath string
+}
+
+// A GlobalId qualifies a NodeId with the package it belongs to, so that it
+// is unique across modules. The Id should be relative to the package's
+// *ast.Package, so that it starts with "Package/Files/<file name>".
+type GlobalId struct {
+	PkgPath
+	Id NodeId
+}
+
+// String returns the global ID in the form
+//
+//	<module>@<version>:<importpath>#<id>
+//
+// where "@<version>" is omitted if Version is empty and "<module>@<version>:"
+// is omitted if Module is empty.
+func (g GlobalId) String() string {
+	var b strings.Builder
+	if g.Module != "" {
+		b.WriteString(g.Module)
+		if g.Version != "" {
+			b.WriteString("@")
+			b.WriteString(g.Version)
+		}
+		b.WriteString(":")
+	}
+	b.WriteString(g.ImportPath)
+	b.WriteString("#")
+	b.WriteString(g.Id.String())
+	return b.String()
+}
+
+// ParseGlobalId parses a global ID in the form returned by GlobalId.String.
+func ParseGlobalId(s string) (GlobalId, error) {
+	var g GlobalId
+	i := strings.Index(s, "#")
+	if i == -1 {
+		return g, errors.New("idast: global ID has no '#': " + s)
+	}
+	pkg := s[:i]
+	if j := strings.Index(pkg, ":"); j != -1 {
+		g.Module, pkg = pkg[:j], pkg[j+1:]
+		if k := strings.Index(g.Module, "@"); k != -1 {
+			g.Module, g.Version = g.Module[:k], g.Module[k+1:]
+		}
+		if g.Module == "" {
+			return g, errors.New("idast: global ID has an empty module: " + s)
+		}
+	}
+	if pkg == "" {
+		return g, errors.New("idast: global ID has an empty import path: " + s)
+	}
+	g.ImportPath = pkg
+	g.Id = ParseNodeId(s[i+1:])
+	return g, nil
+}
+
+// Global qualifies id, as computed by walking with cfg, with cfg.Pkg.
+func (cfg *Config) Global(id NodeId) GlobalId {
+	return GlobalId{cfg.Pkg, id.dup()}
+}
+
+// InspectGlobal is like Inspect, but passes f the global ID of each node,
+// qualified with cfg.Pkg. Walk root from the *ast.Package, so that the IDs
+// start with "Package/Files/<file name>".
+func (cfg *Config) InspectGlobal(root ast.Node, f func(ast.Node, GlobalId) bool) {
+	cfg.Inspect(root, func(n ast.Node, id NodeId) bool {
+		return f(n, cfg.Global(id))
+	})
+}
+
+// MapGlobal is like Map, but maps each node to its global ID, as passed by
+// InspectGlobal.
+func (cfg *Config) MapGlobal(root ast.Node) map[ast.Node]GlobalId {
+	m := make(map[ast.Node]GlobalId)
+	cfg.InspectGlobal(root, func(n ast.Node, g GlobalId) bool {
+		if n != nil {
+			m[n] = g
+		}
+		return true
+	})
+	return m
+}
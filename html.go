@@ -0,0 +1,202 @@
+package idast
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"html"
+	"io"
+	"os"
+	"strings"
+)
+
+// WriteHTML writes to w an HTML page showing the syntax-highlighted source
+// of file, as parsed into fset, preceded by an outline of its top-level
+// declarations. Every node other than comments and the file itself is
+// wrapped in a span whose id attribute is the node's ID, so that
+// page.html#Decls/0/FuncDecl:A/Body links to the body of A. If src is nil,
+// the file named in the FileSet is read.
+func WriteHTML(w io.Writer, fset *token.FileSet, file *ast.File, src []byte) error {
+	return defaultConfig.WriteHTML(w, fset, file, src)
+}
+
+// WriteHTML is like the package-level WriteHTML, computing IDs as configured
+// by cfg.
+func (cfg *Config) WriteHTML(w io.Writer, fset *token.FileSet, file *ast.File, src []byte) error {
+	tf := fset.File(file.Pos())
+	if tf == nil {
+		return errors.New("idast.WriteHTML: file has no position information")
+	}
+	if src == nil {
+		var err error
+		if src, err = os.ReadFile(tf.Name()); err != nil {
+			return err
+		}
+	}
+	if tf.Size() != len(src) {
+		return fmt.Errorf("idast.WriteHTML: source of %s has changed since it was parsed", tf.Name())
+	}
+
+	// Tags to write at each offset: closing tags first, then opening tags,
+	// so that the spans of adjacent nodes don't overlap.
+	closes := make([]int, len(src)+1)
+	opens := make([][]string, len(src)+1)
+
+	type span struct{ start, end int }
+	var stack []span
+	ids := make(map[ast.Node]NodeId)
+	cfg.Walk(visitorFunc(func(n ast.Node, id NodeId) {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return
+		}
+		s := span{tf.Offset(n.Pos()), tf.Offset(n.End())}
+		// Clamp to the parent's span so that spans nest.
+		if len(stack) > 0 {
+			p := stack[len(stack)-1]
+			if s.start < p.start {
+				s.start = p.start
+			}
+			if s.end > p.end {
+				s.end = p.end
+			}
+		}
+		stack = append(stack, s)
+		ids[n] = id.dup()
+		switch n.(type) {
+		case *ast.Comment, *ast.CommentGroup:
+			return
+		}
+		if len(id) == 0 || !n.Pos().IsValid() || s.start >= s.end {
+			return
+		}
+		opens[s.start] = append(opens[s.start], `<span id="`+html.EscapeString(id.String())+`">`)
+		closes[s.end]++
+	}), file)
+
+	// Token classes for highlighting. Tokens never straddle node
+	// boundaries, so their spans go inside those of the nodes.
+	tokOpen := make([]string, len(src)+1)
+	tokClose := make([]bool, len(src)+1)
+	var s scanner.Scanner
+	sf := token.NewFileSet().AddFile("", -1, len(src))
+	s.Init(sf, src, func(token.Position, string) {}, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		class := tokenClass(tok)
+		if class == "" || (tok == token.SEMICOLON && lit == "\n") {
+			continue
+		}
+		start := sf.Offset(pos)
+		end := start + len(tok.String())
+		if lit != "" {
+			end = start + len(lit)
+		}
+		tokOpen[start] = `<span class="` + class + `">`
+		tokClose[end] = true
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n%s</head>\n<body>\n",
+		html.EscapeString(tf.Name()), htmlStyle)
+	writeOutline(bw, file, ids)
+	bw.WriteString("<pre>")
+	for i := 0; i <= len(src); i++ {
+		if tokClose[i] {
+			bw.WriteString("</span>")
+		}
+		bw.WriteString(strings.Repeat("</span>", closes[i]))
+		for _, tag := range opens[i] {
+			bw.WriteString(tag)
+		}
+		bw.WriteString(tokOpen[i])
+		if i < len(src) {
+			bw.WriteString(html.EscapeString(string(src[i : i+1])))
+		}
+	}
+	bw.WriteString("</pre>\n</body>\n</html>\n")
+	return bw.Flush()
+}
+
+const htmlStyle = `<style>
+nav { font-family: sans-serif; }
+pre .kw { color: #00008b; font-weight: bold; }
+pre .str { color: #a31515; }
+pre .num { color: #098658; }
+pre .com { color: #008000; }
+pre span[id]:target { background: #ffffa0; }
+</style>
+`
+
+// tokenClass returns the CSS class used to highlight tok, or "" if it isn't
+// highlighted.
+func tokenClass(tok token.Token) string {
+	switch {
+	case tok.IsKeyword():
+		return "kw"
+	case tok == token.COMMENT:
+		return "com"
+	case tok == token.STRING || tok == token.CHAR:
+		return "str"
+	case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+		return "num"
+	}
+	return ""
+}
+
+// writeOutline writes a list of links to the top-level declarations of file
+// and to the specs of each GenDecl, whose IDs are in ids.
+func writeOutline(w *bufio.Writer, file *ast.File, ids map[ast.Node]NodeId) {
+	link := func(n ast.Node, label string) {
+		id := ids[n]
+		fmt.Fprintf(w, `<a href="#%s">%s</a>`, html.EscapeString(id.String()), html.EscapeString(label))
+	}
+	w.WriteString("<nav>\n<ul>\n")
+	for _, d := range file.Decls {
+		w.WriteString("<li>")
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			label := "func " + d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				label = "func (" + embeddedName(d.Recv.List[0].Type) + ") " + d.Name.Name
+			}
+			link(d, label)
+		case *ast.GenDecl:
+			link(d, d.Tok.String())
+			w.WriteString("\n<ul>\n")
+			for _, s := range d.Specs {
+				w.WriteString("<li>")
+				link(s, specLabel(s))
+				w.WriteString("</li>\n")
+			}
+			w.WriteString("</ul>\n")
+		default:
+			link(d, fmt.Sprintf("%T", d))
+		}
+		w.WriteString("</li>\n")
+	}
+	w.WriteString("</ul>\n</nav>\n")
+}
+
+// specLabel returns the names declared by s, or its import path.
+func specLabel(s ast.Spec) string {
+	switch s := s.(type) {
+	case *ast.TypeSpec:
+		return s.Name.Name
+	case *ast.ValueSpec:
+		var names []string
+		for _, n := range s.Names {
+			names = append(names, n.Name)
+		}
+		return strings.Join(names, ", ")
+	case *ast.ImportSpec:
+		return s.Path.Value
+	}
+	return ""
+}
@@ -0,0 +1,47 @@
+package idast
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"html"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTML(t *testing.T) {
+	src := "package p\n\nimport \"fmt\"\n\n// A prints <x>.\nfunc A(x int) {\n\tfmt.Println(x & 1)\n}\n\ntype T struct{}\n\nfunc (*T) M() {}\n"
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	var b bytes.Buffer
+	if err := WriteHTML(&b, fset, file, []byte(src)); err != nil {
+		t.Fatalf("WriteHTML: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		`<a href="#Decls/0/GenDecl/Specs/ImportSpec:&#34;fmt&#34;">&#34;fmt&#34;</a>`,
+		`<a href="#Decls/1/FuncDecl:A">func A</a>`,
+		`<a href="#Decls/3/FuncDecl:M">func (T) M</a>`,
+		`<span id="Decls/1/FuncDecl:A"><span id="Decls/1/FuncDecl:A/Type/FuncType"><span class="kw">func</span>`,
+		`<span id="Decls/1/FuncDecl:A/Body/BlockStmt">`,
+		`<span class="com">// A prints &lt;x&gt;.</span>`,
+		`<span class="num">1</span>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want output to contain %s\n\ngot:\n%s", want, out)
+		}
+	}
+
+	if opens, closes := strings.Count(out, "<span"), strings.Count(out, "</span>"); opens != closes {
+		t.Errorf("want balanced spans, got %d opening and %d closing tags", opens, closes)
+	}
+	pre := out[strings.Index(out, "<pre>")+len("<pre>") : strings.Index(out, "</pre>")]
+	if text := html.UnescapeString(regexp.MustCompile(`<[^>]*>`).ReplaceAllString(pre, "")); text != src {
+		t.Errorf("want text of source view to be src, got:\n%s", text)
+	}
+}
@@ -7,11 +7,13 @@ import (
 	"go/parser"
 	"go/printer"
 	"go/token"
+	"go/types"
 	"io"
 	"os"
 	"os/exec"
 	"path"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -66,6 +68,562 @@ func TestMapStability(t *testing.T) {
 	}
 }
 
+func TestTypedVisitor(t *testing.T) {
+	src := "package p\nfunc A() { f(g(1)) }\nfunc B() { h() }\n"
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+
+	var funcs, calls []string
+	Walk(&TypedVisitor{
+		FuncDecl: func(n *ast.FuncDecl, id NodeId) bool {
+			funcs = append(funcs, id.String())
+			return n.Name.Name == "A"
+		},
+		CallExpr: func(n *ast.CallExpr, id NodeId) bool {
+			calls = append(calls, id.String())
+			return true
+		},
+	}, file)
+
+	wantFuncs := []string{"Decls/0/FuncDecl:A", "Decls/1/FuncDecl:B"}
+	if !reflect.DeepEqual(funcs, wantFuncs) {
+		t.Errorf("want funcs %v, got %v", wantFuncs, funcs)
+	}
+	wantCalls := []string{
+		"Decls/0/FuncDecl:A/Body/BlockStmt/List/0/ExprStmt/X/CallExpr",
+		"Decls/0/FuncDecl:A/Body/BlockStmt/List/0/ExprStmt/X/CallExpr/Args/0/CallExpr",
+	}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("want calls %v, got %v", wantCalls, calls)
+	}
+}
+
+func TestWalkFrom(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "testdata/funcs.go", nil, 0)
+	if err != nil {
+		t.Fatalf("Error parsing testdata/funcs.go: %v", err)
+	}
+
+	whole := Map(file)
+	decl := file.Decls[1]
+	base, ok := BaseId(file, decl)
+	if !ok {
+		t.Fatalf("BaseId: decl not found in file")
+	}
+	if base.String() != "Decls/1" {
+		t.Errorf("want base Decls/1, got %v", base.String())
+	}
+
+	n := 0
+	WalkFrom(inspector(func(node ast.Node, id NodeId) bool {
+		if node != nil {
+			n++
+			if want := whole[node]; want.String() != id.String() {
+				t.Errorf("want %v, got %v", want.String(), id.String())
+			}
+		}
+		return true
+	}), decl, base)
+	if n == 0 {
+		t.Errorf("WalkFrom visited no nodes")
+	}
+
+	if _, ok := BaseId(decl, file); ok {
+		t.Errorf("BaseId: want file not found in decl")
+	}
+
+	// Struct fields are keyed by name from the field list's base, and a
+	// repeated spec keeps its ordinal when walked at its ID.
+	src := "package p\nimport (\n\t_ \"embed\"\n\t_ \"embed\"\n)\ntype T struct{ A int; io.Reader }\n"
+	file, err = parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	whole = Map(file)
+	fields := file.Decls[1].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(*ast.StructType).Fields
+	dup := file.Decls[0].(*ast.GenDecl).Specs[1]
+	check := func(walk func(v Visitor, n ast.Node, id NodeId), node ast.Node, id NodeId) {
+		n := 0
+		walk(inspector(func(node ast.Node, id NodeId) bool {
+			if node != nil {
+				n++
+				if want := whole[node]; want.String() != id.String() {
+					t.Errorf("want %v, got %v", want.String(), id.String())
+				}
+			}
+			return true
+		}), node, id)
+		if n == 0 {
+			t.Errorf("%T: visited no nodes", node)
+		}
+	}
+	base, _ = BaseId(file, fields)
+	check(WalkFrom, fields, base)
+	check(WalkAt, fields, whole[fields])
+	check(WalkAt, dup, whole[dup])
+	check(WalkAt, file, whole[file])
+}
+
+// An unknownExpr is an expression of a type the walker doesn't know.
+type unknownExpr struct{ *ast.BadExpr }
+
+func TestCheck(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", "package p\nfunc f[T any](c chan T) { for range c {} }\n", 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	if err := Check(file); err != nil {
+		t.Errorf("Check: %v", err)
+	}
+
+	body := file.Decls[0].(*ast.FuncDecl).Body
+	body.List = append(body.List, &ast.ExprStmt{X: unknownExpr{&ast.BadExpr{}}})
+	err = Check(file)
+	uerr, ok := err.(*UnsupportedNodeError)
+	if !ok {
+		t.Fatalf("want *UnsupportedNodeError, got %v", err)
+	}
+	if want := "Decls/0/FuncDecl:f/Body/BlockStmt/List/1/ExprStmt/X/unknownExpr"; uerr.Id.String() != want {
+		t.Errorf("want error at %s, got %s", want, uerr.Id.String())
+	}
+	if n := len(Map(file)); n != 20 {
+		t.Errorf("want 20 nodes walked, got %d", n)
+	}
+}
+
+func TestAt(t *testing.T) {
+	src := "package p\n\nfunc A() {\n\tx := y + 1\n}\n"
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	tests := []struct {
+		at   string
+		kind string
+		id   string
+	}{
+		{"y + 1", "Ident", "Decls/0/FuncDecl:A/Body/BlockStmt/List/0/AssignStmt/Rhs/0/BinaryExpr/X/Ident"},
+		{"+ 1", "BinaryExpr", "Decls/0/FuncDecl:A/Body/BlockStmt/List/0/AssignStmt/Rhs/0/BinaryExpr"},
+		{"}", "BlockStmt", "Decls/0/FuncDecl:A/Body/BlockStmt"},
+		{"A()", "Ident", "Decls/0/FuncDecl:A/Name/Ident"},
+		{"\n\nfunc", "File", ""},
+	}
+	for _, test := range tests {
+		pos := file.Pos() + token.Pos(strings.Index(src, test.at))
+		n, id := At(file, pos)
+		if n == nil {
+			t.Errorf("%q: want %s, got nil", test.at, test.kind)
+			continue
+		}
+		if kind := reflect.TypeOf(n).Elem().Name(); kind != test.kind || id.String() != test.id {
+			t.Errorf("%q: want %s %s, got %s %s", test.at, test.kind, test.id, kind, id.String())
+		}
+	}
+	if n, _ := At(file, file.End()+1); n != nil {
+		t.Errorf("want no node after the end of the file, got %T", n)
+	}
+}
+
+func TestReindex(t *testing.T) {
+	fset := token.NewFileSet()
+	src := "package p\nfunc A() { a() }\nfunc B() { b() }\nfunc C() { c() }\n"
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	index := Map(file)
+
+	// Replace B with a new B, and insert a new declaration before it so that
+	// C's positional ID shifts.
+	edit, err := parser.ParseFile(fset, "edit.go", "package p\nvar x = 1\nfunc B() { b(x) }\n", 0)
+	if err != nil {
+		t.Fatalf("Error parsing edit: %v", err)
+	}
+	oldB := file.Decls[1]
+	file.Decls = []ast.Decl{file.Decls[0], edit.Decls[0], edit.Decls[1], file.Decls[2]}
+	if err := Reindex(index, file, edit.Decls[1]); err != nil {
+		t.Fatalf("Reindex: %v", err)
+	}
+
+	if _, ok := index[oldB]; ok {
+		t.Errorf("want entries for replaced decl removed")
+	}
+	want := Map(file)
+	if len(index) != len(want) {
+		t.Errorf("want %d entries, got %d", len(want), len(index))
+	}
+	for n, id := range want {
+		if got := index[n]; got.String() != id.String() {
+			t.Errorf("%T: want %v, got %v", n, id.String(), got.String())
+		}
+	}
+
+	if err := Reindex(index, file, oldB); err == nil {
+		t.Errorf("want error reindexing a decl not in file")
+	}
+}
+
+func TestStmtHashes(t *testing.T) {
+	cfg := &Config{Mode: StmtHashes}
+	stmtIds := func(src string) []string {
+		file, err := parser.ParseFile(token.NewFileSet(), "p.go", "package p\nfunc A() {\n"+src+"\n}\n", 0)
+		if err != nil {
+			t.Fatalf("Error parsing src: %v", err)
+		}
+		var ids []string
+		for _, s := range file.Decls[0].(*ast.FuncDecl).Body.List {
+			base, _ := cfg.BaseId(file, s)
+			ids = append(ids, base.String())
+		}
+		return ids
+	}
+
+	before := stmtIds("a()\nb()")
+	after := stmtIds("a()\nlog()\nb()")
+	if len(before) != 2 || len(after) != 3 {
+		t.Fatalf("want 2 and 3 statements, got %v and %v", before, after)
+	}
+	if before[0] != after[0] || before[1] != after[2] {
+		t.Errorf("want IDs stable under insertion, got %v and %v", before, after)
+	}
+	if !strings.HasPrefix(before[0], "Decls/0/FuncDecl:A/Body/BlockStmt/List/h") {
+		t.Errorf("want hashed ID, got %v", before[0])
+	}
+
+	dups := stmtIds("a()\n  a( )\na()")
+	if dups[1] != dups[0]+":1" || dups[2] != dups[0]+":2" {
+		t.Errorf("want ordinals for identical statements, got %v", dups)
+	}
+}
+
+func TestNamedFields(t *testing.T) {
+	ids := func(src string) map[string]bool {
+		file, err := parser.ParseFile(token.NewFileSet(), "p.go", "package p\n"+src, 0)
+		if err != nil {
+			t.Fatalf("Error parsing src: %v", err)
+		}
+		m := make(map[string]bool)
+		Inspect(file, func(node ast.Node, id NodeId) bool {
+			if _, ok := node.(*ast.Field); ok {
+				m[id.String()] = true
+			}
+			return true
+		})
+		return m
+	}
+
+	a := ids("type User struct { Name string; Email string; *io.Reader; _, _ int; List[int] }\ntype I interface { M(); fmt.Stringer; Reader() io.Reader }")
+	b := ids("type User struct { Email string; _, _ int; List[int]; *io.Reader; Name string }\ntype I interface { Reader() io.Reader; fmt.Stringer; M() }")
+	for _, want := range []string{
+		"Decls/0/GenDecl/Specs/TypeSpec:User/Type/StructType/Fields/FieldList/List/Email/Field",
+		"Decls/0/GenDecl/Specs/TypeSpec:User/Type/StructType/Fields/FieldList/List/embed:io.Reader/Field",
+		"Decls/0/GenDecl/Specs/TypeSpec:User/Type/StructType/Fields/FieldList/List/embed:List/Field",
+		"Decls/1/GenDecl/Specs/TypeSpec:I/Type/InterfaceType/Methods/FieldList/List/M/Field",
+		"Decls/1/GenDecl/Specs/TypeSpec:I/Type/InterfaceType/Methods/FieldList/List/embed:fmt.Stringer/Field",
+		"Decls/1/GenDecl/Specs/TypeSpec:I/Type/InterfaceType/Methods/FieldList/List/Reader/Field",
+	} {
+		if !a[want] || !b[want] {
+			t.Errorf("want %v before and after reordering", want)
+		}
+	}
+	if !a["Decls/0/GenDecl/Specs/TypeSpec:User/Type/StructType/Fields/FieldList/List/_,_:3/Field"] {
+		t.Errorf("want blank fields keyed by index, got %v", a)
+	}
+
+	// Keys are unique even where names clash.
+	for src, want := range map[string][]string{
+		"type I interface { io.Reader; Reader() }":          {"embed:io.Reader", "Reader"},
+		"type I interface { fmt.Stringer; other.Stringer }": {"embed:fmt.Stringer", "embed:other.Stringer"},
+		"type I interface { Stringer; Stringer }":           {"embed:Stringer", "embed:Stringer:1"},
+		"type C interface { ~int | string; comparable }":    {"0", "embed:comparable"},
+	} {
+		got := ids(src)
+		if len(got) != len(want) {
+			t.Errorf("%s: want %d distinct field IDs, got %v", src, len(want), got)
+		}
+		for _, key := range want {
+			id := "Decls/0/GenDecl/Specs/TypeSpec:" + src[5:6] + "/Type/InterfaceType/Methods/FieldList/List/" + key + "/Field"
+			if !got[id] {
+				t.Errorf("%s: want %s, got %v", src, id, got)
+			}
+		}
+	}
+
+	// A walk that starts at the field list keys the fields the same way.
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", "package p\ntype T struct { A int; io.Reader; B, _ string }\ntype I interface { M(); fmt.Stringer }\n", 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	whole := Map(file)
+	for _, d := range file.Decls {
+		var fl *ast.FieldList
+		switch x := d.(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(type) {
+		case *ast.StructType:
+			fl = x.Fields
+		case *ast.InterfaceType:
+			fl = x.Methods
+		}
+		base, ok := BaseId(file, fl)
+		if !ok {
+			t.Fatalf("BaseId: field list not found in file")
+		}
+		n := 0
+		WalkFrom(inspector(func(node ast.Node, id NodeId) bool {
+			if node != nil {
+				n++
+				if want := whole[node]; want.String() != id.String() {
+					t.Errorf("want %v, got %v", want.String(), id.String())
+				}
+			}
+			return true
+		}), fl, base)
+		if n == 0 {
+			t.Errorf("WalkFrom visited no nodes")
+		}
+	}
+}
+
+func TestSpecComponents(t *testing.T) {
+	src := "package p\nimport (\n\th `net/http`\n\t\"fmt\"\n)\nvar x, y = 1, 2\n"
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	m := Map(file)
+
+	imports := file.Decls[0].(*ast.GenDecl).Specs
+	vars := file.Decls[1].(*ast.GenDecl).Specs
+	for spec, want := range map[ast.Node]string{
+		imports[0]: "Decls/0/GenDecl/Specs/ImportSpec:\"net/http\"",
+		imports[1]: "Decls/0/GenDecl/Specs/ImportSpec:\"fmt\"",
+		vars[0]:    "Decls/1/GenDecl/Specs/ValueSpec:x,y",
+	} {
+		if id := m[spec]; id.String() != want {
+			t.Errorf("want %v, got %v", want, id.String())
+		}
+	}
+
+	// Reordering specs within a group must not change their IDs, and
+	// duplicate keys are told apart by ordinals.
+	ids := func(src string) map[string]bool {
+		file, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+		if err != nil {
+			t.Fatalf("Error parsing %q: %v", src, err)
+		}
+		m := Map(file)
+		ids := make(map[string]bool)
+		for _, spec := range file.Decls[0].(*ast.GenDecl).Specs {
+			id := m[spec]
+			ids[id.String()] = true
+		}
+		return ids
+	}
+	a := ids("package p\nimport (\n\t\"fmt\"\n\t_ \"embed\"\n\t\"os\"\n\t_ \"embed\"\n)\n")
+	b := ids("package p\nimport (\n\t\"os\"\n\t_ \"embed\"\n\t_ \"embed\"\n\t\"fmt\"\n)\n")
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("want reordered import IDs %v, got %v", a, b)
+	}
+	if !a[`Decls/0/GenDecl/Specs/ImportSpec:"embed":1`] {
+		t.Errorf("want ordinal for duplicate import path, got %v", a)
+	}
+	a = ids("package p\nvar (\n\t_ = 1\n\tx = 2\n\t_ = 3\n)\n")
+	b = ids("package p\nvar (\n\tx = 2\n\t_ = 1\n\t_ = 3\n)\n")
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("want reordered var IDs %v, got %v", a, b)
+	}
+	if !a["Decls/0/GenDecl/Specs/ValueSpec:_:1"] {
+		t.Errorf("want ordinal for blank var, got %v", a)
+	}
+}
+
+func TestLocalIds(t *testing.T) {
+	src := `package p
+
+var g = func() {}
+
+func A(n int) (err error) {
+	x := 1
+	x, y := 2, 3
+	f := func() {
+		const c = 1
+		for i, x := range []int{} {
+			_, _ = i, x
+		}
+	}
+	h := func(x int) {
+		type T int
+		switch v := interface{}(x).(type) {
+		default:
+			_ = v
+		}
+	}
+	return nil
+}
+`
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+
+	var got []string
+	for _, id := range LocalIds(file) {
+		got = append(got, id.String())
+	}
+	sort.Strings(got)
+	want := []string{
+		"FuncDecl:A",
+		"FuncDecl:A/func#1",
+		"FuncDecl:A/func#1/const:c",
+		"FuncDecl:A/func#1/var:i",
+		"FuncDecl:A/func#1/var:x",
+		"FuncDecl:A/func#2",
+		"FuncDecl:A/func#2/param:x",
+		"FuncDecl:A/func#2/type:T",
+		"FuncDecl:A/func#2/var:v",
+		"FuncDecl:A/param:err",
+		"FuncDecl:A/param:n",
+		"FuncDecl:A/var:f",
+		"FuncDecl:A/var:h",
+		"FuncDecl:A/var:x",
+		"FuncDecl:A/var:y",
+		"func#1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	// Methods are qualified by receiver type, so reordering them keeps
+	// their IDs; only real duplicates get an ordinal.
+	methods := func(src string) []string {
+		file, err := parser.ParseFile(token.NewFileSet(), "p.go", "package p\n"+src, 0)
+		if err != nil {
+			t.Fatalf("Error parsing src: %v", err)
+		}
+		var ids []string
+		for n, id := range LocalIds(file) {
+			if _, ok := n.(*ast.FuncDecl); ok {
+				ids = append(ids, id.String())
+			}
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	a := methods("func (T) String() string { x := 1; return \"\" }\nfunc (*U) String() string { return \"\" }\nfunc init() {}\nfunc init() {}\n")
+	b := methods("func (*U) String() string { return \"\" }\nfunc init() {}\nfunc (T) String() string { x := 1; return \"\" }\nfunc init() {}\n")
+	want = []string{"FuncDecl:T.String", "FuncDecl:U.String", "FuncDecl:init", "FuncDecl:init#2"}
+	if !reflect.DeepEqual(a, want) || !reflect.DeepEqual(b, want) {
+		t.Errorf("want %v before and after reordering, got %v and %v", want, a, b)
+	}
+}
+
+func TestIndexObjects(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "testdata/funcs.go", nil, 0)
+	if err != nil {
+		t.Fatalf("Error parsing testdata/funcs.go: %v", err)
+	}
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object), Uses: make(map[*ast.Ident]types.Object)}
+	pkg, err := new(types.Config).Check("vars", fset, []*ast.File{file}, info)
+	if err != nil {
+		t.Fatalf("Error type-checking testdata/funcs.go: %v", err)
+	}
+
+	x := IndexObjects(file, info)
+	a := pkg.Scope().Lookup("A")
+	if id := x.Ids[a]; id.String() != "Decls/0/FuncDecl:A/Name/Ident" {
+		t.Errorf("want A declared at Decls/0/FuncDecl:A/Name/Ident, got %v", id.String())
+	}
+
+	b := x.Objects["Decls/0/FuncDecl:A/Type/FuncType/Params/FieldList/List/0/Field/Names/b/Ident"]
+	use := x.Objects["Decls/0/FuncDecl:A/Body/BlockStmt/List/0/ReturnStmt/Results/0/BinaryExpr/X/CallExpr/Args/0/BinaryExpr/X/Ident"]
+	if b == nil || b != use {
+		t.Errorf("want use of b to resolve to its definition, got %v and %v", b, use)
+	}
+	if obj := x.Objects["Decls/0/FuncDecl:A/Body/BlockStmt/List/0/ReturnStmt/Results/0/BinaryExpr/X/CallExpr/Fun/Ident"]; obj != types.Universe.Lookup("len") {
+		t.Errorf("want len to resolve to the builtin, got %v", obj)
+	}
+}
+
+func TestXRef(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "testdata/funcs.go", nil, 0)
+	if err != nil {
+		t.Fatalf("Error parsing testdata/funcs.go: %v", err)
+	}
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object), Uses: make(map[*ast.Ident]types.Object)}
+	if _, err := new(types.Config).Check("vars", fset, []*ast.File{file}, info); err != nil {
+		t.Fatalf("Error type-checking testdata/funcs.go: %v", err)
+	}
+
+	const def = "Decls/0/FuncDecl:A/Type/FuncType/Params/FieldList/List/0/Field/Names/b/Ident"
+	const use = "Decls/0/FuncDecl:A/Body/BlockStmt/List/0/ReturnStmt/Results/0/BinaryExpr/X/CallExpr/Args/0/BinaryExpr/X/Ident"
+	for _, info := range []*types.Info{info, nil} {
+		x := NewXRef(file, info)
+		refs := x.Refs()[def]
+		if len(refs) != 1 || refs[0].String() != use {
+			t.Errorf("want refs of b [%v], got %v", use, refs)
+		}
+		if got, ok := x.Def(refs[0]); !ok || got.String() != def {
+			t.Errorf("want def of use %v, got %v", def, got.String())
+		}
+		if _, ok := x.Def(NodeId{"Decls", "0", "FuncDecl:A", "Body", "BlockStmt", "List", "0", "ReturnStmt", "Results", "0", "BinaryExpr", "X", "CallExpr", "Fun", "Ident"}); ok {
+			t.Errorf("want no def for builtin len")
+		}
+	}
+}
+
+func TestGlobalId(t *testing.T) {
+	id := NodeId{"Package", "Files", "x.go", "Decls", "0", "GenDecl", "Specs", `ImportSpec:"net/http"`}
+	tests := []struct {
+		pkg  PkgPath
+		want string
+	}{
+		{PkgPath{"example.com/m", "v1.2.0", "example.com/m/p"}, `example.com/m@v1.2.0:example.com/m/p#Package/Files/x.go/Decls/0/GenDecl/Specs/ImportSpec:"net/http"`},
+		{PkgPath{"example.com/m", "", "example.com/m/p"}, `example.com/m:example.com/m/p#Package/Files/x.go/Decls/0/GenDecl/Specs/ImportSpec:"net/http"`},
+		{PkgPath{"", "", "fmt"}, `fmt#Package/Files/x.go/Decls/0/GenDecl/Specs/ImportSpec:"net/http"`},
+	}
+	for _, test := range tests {
+		cfg := &Config{Pkg: test.pkg}
+		g := cfg.Global(id)
+		if s := g.String(); s != test.want {
+			t.Errorf("want %v, got %v", test.want, s)
+		}
+		parsed, err := ParseGlobalId(test.want)
+		if err != nil {
+			t.Errorf("ParseGlobalId(%q): %v", test.want, err)
+			continue
+		}
+		if !reflect.DeepEqual(parsed, g) {
+			t.Errorf("ParseGlobalId(%q): want %+v, got %+v", test.want, g, parsed)
+		}
+	}
+
+	// Walking with a Pkg gives global IDs directly.
+	file, err := parser.ParseFile(token.NewFileSet(), "x.go", "package p\nimport \"net/http\"\n", 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	pkg := &ast.Package{Name: "p", Files: map[string]*ast.File{"x.go": file}}
+	cfg := &Config{Pkg: tests[0].pkg}
+	m := cfg.MapGlobal(pkg)
+	if g := m[file.Imports[0]]; g.String() != tests[0].want {
+		t.Errorf("MapGlobal: want %v, got %v", tests[0].want, g.String())
+	}
+	if len(m) != len(cfg.Map(pkg)) {
+		t.Errorf("MapGlobal: want %d nodes, got %d", len(cfg.Map(pkg)), len(m))
+	}
+
+	for _, s := range []string{"fmt", "#Files", ":fmt#Files", "m:#Files"} {
+		if _, err := ParseGlobalId(s); err == nil {
+			t.Errorf("ParseGlobalId(%q): want error", s)
+		}
+	}
+}
+
 func BenchmarkCollect(b *testing.B) {
 	b.StopTimer()
 
@@ -86,6 +644,44 @@ func BenchmarkCollect(b *testing.B) {
 	}
 }
 
+// BenchmarkTypedVisitor and BenchmarkSwitchVisitor compare a TypedVisitor
+// with the equivalent hand-written type switch.
+func BenchmarkTypedVisitor(b *testing.B) {
+	n := 0
+	benchmarkVisitor(b, &TypedVisitor{
+		CallExpr: func(*ast.CallExpr, NodeId) bool {
+			n++
+			return true
+		},
+	})
+}
+
+func BenchmarkSwitchVisitor(b *testing.B) {
+	n := 0
+	var f inspector
+	f = func(node ast.Node, id NodeId) bool {
+		switch node.(type) {
+		case *ast.CallExpr:
+			n++
+		}
+		return true
+	}
+	benchmarkVisitor(b, f)
+}
+
+func benchmarkVisitor(b *testing.B, v Visitor) {
+	b.StopTimer()
+	file, err := parser.ParseFile(token.NewFileSet(), "testdata/print.go", nil, parser.ParseComments)
+	if err != nil {
+		b.Fatalf("Error parsing testdata/print.go: %v", err)
+	}
+	b.StartTimer()
+
+	for i := 0; i < b.N; i++ {
+		Walk(v, file)
+	}
+}
+
 func BenchmarkMap(b *testing.B) {
 	b.StopTimer()
 	src := "1 + 2 + 3 + 4 + 5 + 6 + 7 + 8 + 9 + 10 + 11 + 12 + 13 + 14"
@@ -0,0 +1,181 @@
+package idast
+
+import (
+	"bufio"
+	"errors"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A LoadConfig controls which files Load parses and how IDs are computed.
+type LoadConfig struct {
+	// GOOS and GOARCH select the target platform for build constraints.
+	// They default to those of build.Default.
+	GOOS   string
+	GOARCH string
+
+	// BuildTags are the additional build tags that are satisfied.
+	BuildTags []string
+
+	// Tests includes the package's _test.go files. External test files
+	// (package p_test) are loaded as a separate package whose import path
+	// has a "_test" suffix.
+	Tests bool
+
+	// Mode controls how IDs are computed.
+	Mode Mode
+}
+
+// A LoadedPackage is a package parsed by Load, together with its ID index.
+type LoadedPackage struct {
+	Dir     string
+	Fset    *token.FileSet
+	Package *ast.Package
+
+	// Config is the configuration the index was built with. Its Pkg
+	// identifies the package, so Config.Global qualifies the IDs in Index,
+	// and Config.MapGlobal computes global IDs directly.
+	Config *Config
+
+	// Index maps each node in Package to its ID, as returned by Map.
+	Index map[ast.Node]NodeId
+}
+
+// Load parses every package in the module rooted at dir (which must contain
+// a go.mod file) for the platform and build tags in cfg, and indexes each
+// one. A package containing a node that the walker doesn't know is an error
+// (see Check). As with the go command, directories named testdata or vendor, or
+// whose names begin with "." or "_", and nested modules are skipped.
+func Load(dir string, cfg LoadConfig) ([]*LoadedPackage, error) {
+	modPath, err := readModulePath(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+
+	ctxt := build.Default
+	if cfg.GOOS != "" {
+		ctxt.GOOS = cfg.GOOS
+	}
+	if cfg.GOARCH != "" {
+		ctxt.GOARCH = cfg.GOARCH
+	}
+	ctxt.BuildTags = cfg.BuildTags
+
+	var pkgs []*LoadedPackage
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != dir {
+			name := d.Name()
+			if name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+
+		bp, err := ctxt.ImportDir(p, 0)
+		if _, ok := err.(*build.NoGoError); ok {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		importPath := path.Join(modPath, filepath.ToSlash(rel))
+
+		files := append(append([]string{}, bp.GoFiles...), bp.CgoFiles...)
+		if cfg.Tests {
+			files = append(files, bp.TestGoFiles...)
+		}
+		if len(files) > 0 {
+			lp, err := loadPackage(p, bp.Name, files, &Config{Mode: cfg.Mode, Pkg: PkgPath{Module: modPath, ImportPath: importPath}})
+			if err != nil {
+				return err
+			}
+			pkgs = append(pkgs, lp)
+		}
+		if cfg.Tests && len(bp.XTestGoFiles) > 0 {
+			lp, err := loadPackage(p, bp.Name+"_test", bp.XTestGoFiles, &Config{Mode: cfg.Mode, Pkg: PkgPath{Module: modPath, ImportPath: importPath + "_test"}})
+			if err != nil {
+				return err
+			}
+			pkgs = append(pkgs, lp)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkgs, nil
+}
+
+func loadPackage(dir, name string, filenames []string, cfg *Config) (*LoadedPackage, error) {
+	fset := token.NewFileSet()
+	pkg := &ast.Package{Name: name, Files: make(map[string]*ast.File, len(filenames))}
+	for _, filename := range filenames {
+		filename = filepath.Join(dir, filename)
+		f, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		pkg.Files[filename] = f
+	}
+	if err := cfg.Check(pkg); err != nil {
+		return nil, err
+	}
+	return &LoadedPackage{
+		Dir:     dir,
+		Fset:    fset,
+		Package: pkg,
+		Config:  cfg,
+		Index:   cfg.Map(pkg),
+	}, nil
+}
+
+// readModulePath returns the module path declared in the go.mod file at
+// filename.
+func readModulePath(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if i := strings.Index(line, "//"); i != -1 {
+			line = strings.TrimSpace(line[:i])
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "module" {
+			continue
+		}
+		mod := fields[1]
+		if unquoted, err := strconv.Unquote(mod); err == nil {
+			mod = unquoted
+		}
+		return mod, nil
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("idast: no module declaration in " + filename)
+}
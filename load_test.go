@@ -0,0 +1,165 @@
+package idast
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":              "module example.com/m // comment\n\ngo 1.21\n",
+		"a.go":                "package m\n",
+		"a_linux.go":          "package m\nfunc open() {}\n",
+		"a_windows.go":        "package m\nfunc open() {}\n",
+		"tagged.go":           "//go:build special\n\npackage m\n",
+		"a_test.go":           "package m\n",
+		"x_test.go":           "package m_test\n",
+		"sub/b.go":            "package sub\n",
+		"sub/generic.go":      "package sub\ntype P[K comparable, V any] map[K]V\nvar x P[int, string]\nfunc f[T any](c chan T, s []T) { for range c {}; _ = s[0:1:1] }\n",
+		"testdata/skipped.go": "package skipped\n",
+		"nested/go.mod":       "module example.com/nested\n",
+		"nested/c.go":         "package nested\n",
+	}
+	for name, src := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		cfg  LoadConfig
+		want map[string][]string
+	}{
+		{
+			LoadConfig{GOOS: "linux", GOARCH: "amd64"},
+			map[string][]string{
+				"example.com/m":     {"a.go", "a_linux.go"},
+				"example.com/m/sub": {"b.go", "generic.go"},
+			},
+		},
+		{
+			LoadConfig{GOOS: "windows", GOARCH: "amd64", BuildTags: []string{"special"}, Tests: true},
+			map[string][]string{
+				"example.com/m":      {"a.go", "a_test.go", "a_windows.go", "tagged.go"},
+				"example.com/m_test": {"x_test.go"},
+				"example.com/m/sub":  {"b.go", "generic.go"},
+			},
+		},
+	}
+	for _, test := range tests {
+		pkgs, err := Load(dir, test.cfg)
+		if err != nil {
+			t.Fatalf("Load(%+v): %v", test.cfg, err)
+		}
+		got := make(map[string][]string)
+		for _, p := range pkgs {
+			var names []string
+			for filename := range p.Package.Files {
+				names = append(names, filepath.Base(filename))
+			}
+			sort.Strings(names)
+			got[p.Config.Pkg.ImportPath] = names
+			if p.Config.Pkg.Module != "example.com/m" {
+				t.Errorf("want module example.com/m, got %v", p.Config.Pkg.Module)
+			}
+			if id := p.Index[p.Package]; id.String() != "Package" {
+				t.Errorf("want package ID Package, got %v", id.String())
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Load(%+v): want %v, got %v", test.cfg, test.want, got)
+		}
+	}
+
+	if _, err := Load(filepath.Join(dir, "sub"), LoadConfig{}); err == nil {
+		t.Errorf("want error loading a directory without go.mod")
+	}
+
+	// Generics and ranges without a key are walked.
+	pkgs, err := Load(dir, LoadConfig{})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	ids := make(map[string]bool)
+	for _, p := range pkgs {
+		if p.Config.Pkg.ImportPath == "example.com/m/sub" {
+			for _, id := range p.Index {
+				ids[id.String()] = true
+			}
+		}
+	}
+	prefix := "Package/Files/generic.go"
+	for _, want := range []string{
+		"/Decls/0/GenDecl/Specs/TypeSpec:P/TypeParams/FieldList/List/1/Field/Names/V/Ident",
+		"/Decls/1/GenDecl/Specs/ValueSpec:x/Type/IndexListExpr/Indices/1/Ident",
+		"/Decls/2/FuncDecl:f/Type/FuncType/TypeParams/FieldList",
+		"/Decls/2/FuncDecl:f/Body/BlockStmt/List/0/RangeStmt/X/Ident",
+		"/Decls/2/FuncDecl:f/Body/BlockStmt/List/1/AssignStmt/Rhs/0/SliceExpr/Max/BasicLit",
+	} {
+		if !ids[prefix+want] {
+			t.Errorf("want ID %s in package sub", prefix+want)
+		}
+	}
+}
+
+func TestVariants(t *testing.T) {
+	fset := token.NewFileSet()
+	pkg := &ast.Package{Name: "p", Files: make(map[string]*ast.File)}
+	for name, src := range map[string]string{
+		"open_linux.go":         "package p\nfunc open() {}\ntype T int\nfunc (*T) M() {}\n",
+		"open_windows_amd64.go": "package p\nfunc open() {}\ntype T int\nfunc (T) M() {}\n",
+		"open_other.go":         "// Copyright\n\n//go:build !linux && !windows\n\npackage p\nfunc open() {}\n",
+		"common.go":             "package p\nvar x, y = 1, 2\nfunc M() {}\n",
+	} {
+		f, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %v", name, err)
+		}
+		pkg.Files[name] = f
+	}
+
+	cfg := &Config{Mode: FileConstraints}
+	got := make(map[string][]string)
+	for key, ids := range cfg.Variants(pkg) {
+		for _, id := range ids {
+			got[key] = append(got[key], id.String())
+		}
+		sort.Strings(got[key])
+	}
+	want := map[string][]string{
+		"FuncDecl:open": {
+			"Package/Files/open_linux.go(linux)/Decls/0/FuncDecl:open",
+			"Package/Files/open_other.go(!linux&&!windows)/Decls/0/FuncDecl:open",
+			"Package/Files/open_windows_amd64.go(windows&&amd64)/Decls/0/FuncDecl:open",
+		},
+		"TypeSpec:T": {
+			"Package/Files/open_linux.go(linux)/Decls/1/GenDecl/Specs/TypeSpec:T",
+			"Package/Files/open_windows_amd64.go(windows&&amd64)/Decls/1/GenDecl/Specs/TypeSpec:T",
+		},
+		"FuncDecl:T.M": {
+			"Package/Files/open_linux.go(linux)/Decls/2/FuncDecl:M",
+			"Package/Files/open_windows_amd64.go(windows&&amd64)/Decls/2/FuncDecl:M",
+		},
+		"ValueSpec:x,y": {"Package/Files/common.go/Decls/0/GenDecl/Specs/ValueSpec:x,y"},
+		"FuncDecl:M":    {"Package/Files/common.go/Decls/1/FuncDecl:M"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if ids := Variants(pkg)["FuncDecl:open"]; len(ids) != 3 || strings.Contains(ids[0].String(), "(") {
+		t.Errorf("want unannotated file components by default, got %v", ids)
+	}
+}
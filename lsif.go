@@ -0,0 +1,211 @@
+package idast
+
+import (
+	"bufio"
+	"encoding/json"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"unicode/utf8"
+)
+
+// LSIFVersion is the version of the LSIF format written by WriteLSIF.
+const LSIFVersion = "0.4.3"
+
+// WriteLSIF writes an LSIF index of pkg to w, as a stream of JSON lines.
+// Every identifier that NewXRef(pkg.Package, info) links to a declaration in
+// the package gets a range; the definition and reference results of each
+// declaration are attached to a result set, together with an "idast"
+// moniker whose identifier is the global ID (as returned by
+// pkg.Config.Global) of the declaring identifier. References to other
+// packages are not indexed.
+//
+// As with NewXRef, info may be nil. The package's source files are read to
+// compute the UTF-16 character offsets that LSIF ranges use.
+func WriteLSIF(w io.Writer, pkg *LoadedPackage, info *types.Info) error {
+	type identWithId struct {
+		ident *ast.Ident
+		id    NodeId
+		file  string
+	}
+	x := pkg.Config.NewXRef(pkg.Package, info)
+	var idents []identWithId
+	pkg.Config.Inspect(pkg.Package, func(n ast.Node, id NodeId) bool {
+		if ident, ok := n.(*ast.Ident); ok {
+			if _, ok := x.Def(id); ok {
+				idents = append(idents, identWithId{ident, id.dup(), pkg.Fset.PositionFor(ident.Pos(), false).Filename})
+			}
+		}
+		return true
+	})
+	// Files are walked in map order; keep walk order within each file.
+	sort.SliceStable(idents, func(i, j int) bool {
+		return idents[i].file < idents[j].file
+	})
+
+	e := &lsifEncoder{w: bufio.NewWriter(w)}
+	root, err := filepath.Abs(pkg.Dir)
+	if err != nil {
+		return err
+	}
+	e.emit(map[string]interface{}{
+		"type": "vertex", "label": "metaData", "version": LSIFVersion,
+		"projectRoot": fileURI(root), "positionEncoding": "utf-16",
+		"toolInfo": map[string]string{"name": "idast"},
+	})
+	project := e.emit(map[string]interface{}{"type": "vertex", "label": "project", "kind": "go"})
+
+	// Documents and their ranges.
+	var docs []int
+	ranges := make(map[string]int) // by ID
+	docOf := make(map[int]int)     // range to document
+	for i := 0; i < len(idents); {
+		file := idents[i].file
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		doc := e.emit(map[string]interface{}{"type": "vertex", "label": "document", "uri": fileURI(abs), "languageId": "go"})
+		docs = append(docs, doc)
+		var contained []int
+		for ; i < len(idents) && idents[i].file == file; i++ {
+			start := pkg.Fset.PositionFor(idents[i].ident.Pos(), false)
+			end := pkg.Fset.PositionFor(idents[i].ident.End(), false)
+			r := e.emit(map[string]interface{}{
+				"type": "vertex", "label": "range",
+				"start": lsifPosition(src, start), "end": lsifPosition(src, end),
+			})
+			ranges[idents[i].id.String()] = r
+			docOf[r] = doc
+			contained = append(contained, r)
+		}
+		e.edge("contains", doc, contained...)
+	}
+	if len(docs) > 0 {
+		e.edge("contains", project, docs...)
+	}
+
+	// Result sets of declarations, in the order they were first seen.
+	for _, i := range idents {
+		s := i.id.String()
+		if def, _ := x.Def(i.id); def.String() != s {
+			continue
+		}
+		def := ranges[s]
+		set := e.emit(map[string]interface{}{"type": "vertex", "label": "resultSet"})
+		e.edge("next", def, set)
+		for _, ref := range x.Refs()[s] {
+			e.edge("next", ranges[ref.String()], set)
+		}
+
+		kind := "local"
+		if i.ident.IsExported() {
+			kind = "export"
+		}
+		m := e.emit(map[string]interface{}{
+			"type": "vertex", "label": "moniker", "scheme": "idast", "kind": kind,
+			"unique": "global", "identifier": pkg.Config.Global(i.id).String(),
+		})
+		e.edge("moniker", set, m)
+
+		defResult := e.emit(map[string]interface{}{"type": "vertex", "label": "definitionResult"})
+		e.edge("textDocument/definition", set, defResult)
+		e.item(defResult, docOf[def], "", def)
+
+		refResult := e.emit(map[string]interface{}{"type": "vertex", "label": "referenceResult"})
+		e.edge("textDocument/references", set, refResult)
+		e.item(refResult, docOf[def], "definitions", def)
+		byDoc := make(map[int][]int)
+		var order []int
+		for _, ref := range x.Refs()[s] {
+			r := ranges[ref.String()]
+			if _, ok := byDoc[docOf[r]]; !ok {
+				order = append(order, docOf[r])
+			}
+			byDoc[docOf[r]] = append(byDoc[docOf[r]], r)
+		}
+		for _, doc := range order {
+			e.item(refResult, doc, "references", byDoc[doc]...)
+		}
+	}
+	return e.flush()
+}
+
+// An lsifEncoder writes LSIF vertices and edges, numbering them in order.
+type lsifEncoder struct {
+	w   *bufio.Writer
+	id  int
+	err error
+}
+
+// emit writes the element v, which must not have an ID, and returns the ID
+// it was given.
+func (e *lsifEncoder) emit(v map[string]interface{}) int {
+	e.id++
+	v["id"] = e.id
+	b, err := json.Marshal(v)
+	if err != nil && e.err == nil {
+		e.err = err
+	}
+	e.w.Write(b)
+	e.w.WriteByte('\n')
+	return e.id
+}
+
+// edge writes an edge from out to in, using inV for a single in vertex as
+// the 1:1 edges of LSIF require.
+func (e *lsifEncoder) edge(label string, out int, in ...int) {
+	v := map[string]interface{}{"type": "edge", "label": label, "outV": out}
+	if label == "contains" {
+		v["inVs"] = in
+	} else {
+		v["inV"] = in[0]
+	}
+	e.emit(v)
+}
+
+// item writes an item edge from a result to ranges in doc, with the given
+// property if it is not empty.
+func (e *lsifEncoder) item(out, doc int, property string, in ...int) {
+	v := map[string]interface{}{"type": "edge", "label": "item", "outV": out, "inVs": in, "document": doc}
+	if property != "" {
+		v["property"] = property
+	}
+	e.emit(v)
+}
+
+func (e *lsifEncoder) flush() error {
+	if err := e.w.Flush(); err != nil {
+		return err
+	}
+	return e.err
+}
+
+// lsifPosition returns the zero-based line and UTF-16 character of p in src.
+func lsifPosition(src []byte, p token.Position) map[string]int {
+	line := src[p.Offset-(p.Column-1) : p.Offset]
+	char := 0
+	for len(line) > 0 {
+		r, size := utf8.DecodeRune(line)
+		line = line[size:]
+		char++
+		if r >= 0x10000 {
+			char++
+		}
+	}
+	return map[string]int{"line": p.Line - 1, "character": char}
+}
+
+// fileURI returns the file URI of the absolute path p.
+func fileURI(p string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(p)}).String()
+}
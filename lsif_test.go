@@ -0,0 +1,147 @@
+package idast
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestWriteLSIF(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/m\n",
+		"a.go":   "package m\n\nfunc F() string { return \"\" }\n",
+		"b.go":   "package m\n\nvar G = \"😀\" + F()\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pkgs, err := Load(dir, LoadConfig{})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	pkg := pkgs[0]
+	var astFiles []*ast.File
+	var names []string
+	for name := range pkg.Package.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		astFiles = append(astFiles, pkg.Package.Files[name])
+	}
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object), Uses: make(map[*ast.Ident]types.Object)}
+	if _, err := (&types.Config{}).Check("example.com/m", pkg.Fset, astFiles, info); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	var b bytes.Buffer
+	if err := WriteLSIF(&b, pkg, info); err != nil {
+		t.Fatalf("WriteLSIF: %v", err)
+	}
+
+	type position struct{ Line, Character int }
+	type element struct {
+		Id         int
+		Type       string
+		Label      string
+		Uri        string
+		Identifier string
+		Start      position
+		OutV, InV  int
+		InVs       []int
+	}
+	elems := make(map[int]element)
+	var monikers []string
+	for i, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		var e element
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+		if e.Id != i+1 {
+			t.Errorf("line %d: want ID %d, got %d", i+1, i+1, e.Id)
+		}
+		if e.Type == "edge" {
+			for _, v := range append([]int{e.OutV, e.InV}, e.InVs...) {
+				if _, ok := elems[v]; v != 0 && !ok {
+					t.Errorf("line %d: edge to unknown vertex %d", i+1, v)
+				}
+			}
+		}
+		if e.Type == "vertex" && e.Label == "moniker" {
+			monikers = append(monikers, e.Identifier)
+		}
+		elems[e.Id] = e
+	}
+
+	wantMonikers := []string{
+		"example.com/m:example.com/m#Package/Files/a.go/Decls/0/FuncDecl:F/Name/Ident",
+		"example.com/m:example.com/m#Package/Files/b.go/Decls/0/GenDecl/Specs/ValueSpec:G/Names/G/Ident",
+	}
+	if strings.Join(monikers, "\n") != strings.Join(wantMonikers, "\n") {
+		t.Errorf("want monikers %q, got %q", wantMonikers, monikers)
+	}
+
+	// The use of F in b.go must lead to F's moniker.
+	var found bool
+	for _, e := range elems {
+		if e.Label != "range" || e.Start != (position{2, 15}) {
+			continue
+		}
+		for _, next := range elems {
+			if next.Label != "next" || next.OutV != e.Id {
+				continue
+			}
+			for _, m := range elems {
+				if m.Type == "edge" && m.Label == "moniker" && m.OutV == next.InV {
+					found = elems[m.InV].Identifier == wantMonikers[0]
+				}
+			}
+		}
+	}
+	if !found {
+		t.Errorf("want the use of F at 2:15 to link to %s", wantMonikers[0])
+	}
+}
+
+func TestWriteLSIFLineDirective(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/m\n",
+		"a.go":   "package m\n\n//line other.y:1:80\nfunc F() {}\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pkgs, err := Load(dir, LoadConfig{})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object), Uses: make(map[*ast.Ident]types.Object)}
+	if _, err := (&types.Config{}).Check("example.com/m", pkgs[0].Fset, []*ast.File{pkgs[0].Package.Files[filepath.Join(dir, "a.go")]}, info); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	var b bytes.Buffer
+	if err := WriteLSIF(&b, pkgs[0], info); err != nil {
+		t.Fatalf("WriteLSIF: %v", err)
+	}
+	// The document and F's range are in a.go as written, not in other.y.
+	out := b.String()
+	if !strings.Contains(out, `"uri":"`+fileURI(filepath.Join(dir, "a.go"))+`"`) || strings.Contains(out, "other.y") {
+		t.Errorf("want the document for a.go, got:\n%s", out)
+	}
+	if !strings.Contains(out, `"start":{"character":5,"line":3}`) {
+		t.Errorf("want F's range at 3:5, got:\n%s", out)
+	}
+}
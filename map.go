@@ -2,11 +2,17 @@ package idast
 
 import (
 	"go/ast"
+	"go/token"
 )
 
 func Map(node ast.Node) map[ast.Node]NodeId {
+	return defaultConfig.Map(node)
+}
+
+// Map is like the package-level Map, computing IDs as configured by cfg.
+func (cfg *Config) Map(node ast.Node) map[ast.Node]NodeId {
 	m := make(map[ast.Node]NodeId, 0)
-	Inspect(node, func(node ast.Node, id NodeId) bool {
+	cfg.Inspect(node, func(node ast.Node, id NodeId) bool {
 		if node != nil {
 			m[node] = id.dup()
 		}
@@ -14,3 +20,91 @@ func Map(node ast.Node) map[ast.Node]NodeId {
 	})
 	return m
 }
+
+// BaseId returns the ID that node's own ID component is appended to when
+// root is walked, i.e., the base to pass to WalkFrom to walk node with IDs
+// that match those of root. The bool is false if node is not in root.
+//
+// The base does not include an ordinal that the walker appends to node's
+// component, as for a spec that repeats the key of an earlier spec; see
+// WalkFrom. To walk such a node, pass its ID from Map to WalkAt instead.
+func BaseId(root, node ast.Node) (NodeId, bool) {
+	return defaultConfig.BaseId(root, node)
+}
+
+// BaseId is like the package-level BaseId, computing IDs as configured by
+// cfg.
+func (cfg *Config) BaseId(root, node ast.Node) (NodeId, bool) {
+	var base NodeId
+	found := false
+	cfg.Inspect(root, func(n ast.Node, id NodeId) bool {
+		if found {
+			return false
+		}
+		if n == node {
+			found = true
+			base = id.dup()
+			if idComponent(node) != "" {
+				base.pop()
+			}
+			return false
+		}
+		return true
+	})
+	return base, found
+}
+
+// Find returns the node in root with the given ID, or nil if there is none.
+func Find(root ast.Node, id NodeId) ast.Node {
+	return defaultConfig.Find(root, id)
+}
+
+// Find is like the package-level Find, computing IDs as configured by cfg.
+func (cfg *Config) Find(root ast.Node, id NodeId) ast.Node {
+	target := id.String()
+	var found ast.Node
+	cfg.Inspect(root, func(n ast.Node, nid NodeId) bool {
+		if found != nil || n == nil {
+			return false
+		}
+		if nid.String() == target {
+			found = n
+			return false
+		}
+		return id.hasPrefix(nid)
+	})
+	return found
+}
+
+// At returns the innermost node in root whose source extends over pos, and
+// its ID, or nil if there is none. Comments are ignored.
+func At(root ast.Node, pos token.Pos) (ast.Node, NodeId) {
+	return defaultConfig.At(root, pos)
+}
+
+// At is like the package-level At, computing IDs as configured by cfg.
+func (cfg *Config) At(root ast.Node, pos token.Pos) (ast.Node, NodeId) {
+	var found ast.Node
+	var id NodeId
+	cfg.Inspect(root, func(n ast.Node, nid NodeId) bool {
+		if n == nil {
+			return false
+		}
+		switch n.(type) {
+		case *ast.Comment, *ast.CommentGroup:
+			return false
+		case *ast.Package:
+			return true
+		}
+		if pos < n.Pos() || pos >= n.End() {
+			return false
+		}
+		// A node's range can extend over a sibling's, as the FuncType of a
+		// FuncDecl does over its Name; prefer the narrower node.
+		if found == nil || n.End()-n.Pos() <= found.End()-found.Pos() {
+			found, id = n, nid.dup()
+		}
+		return true
+	})
+	return found, id
+}
@@ -0,0 +1,523 @@
+package idast
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A MergeConflict is a node that Merge could not merge automatically. Merge
+// keeps our version of it, if we have one.
+type MergeConflict struct {
+	// Id is the node's ID in ours, or in theirs if ours does not have it.
+	Id     NodeId
+	Reason string
+}
+
+// Merge performs a three-way structural merge of two versions, ours and
+// theirs, of a Go file derived from base, and returns the merged file and any
+// conflicts.
+//
+// Top-level declarations are paired across the three versions by name rather
+// than by position: functions and methods by their ID component (methods
+// qualified by receiver type, as in Variants), type, var and const
+// declarations by the names they declare (a group that declares any name of a
+// group in base is paired with that group), and import declarations as a
+// whole, one per file. A declaration changed, added or deleted on only one
+// side takes that side's version. A node that both sides changed is merged
+// recursively, pairing its children by ID: the specs of a declaration group
+// and the fields of a struct or interface by name, and other children by
+// field and index, so that both sides can edit different statements of the
+// same block or different arguments of the same call. Lists such as
+// statements and arguments are first aligned as by diff3, by a longest
+// common subsequence of their printed source, so that an insertion on one
+// side does not shift the other side's edits; both sides adding or removing
+// items at the same place is a conflict. Otherwise a conflict is reported
+// only for a node that both sides changed differently in itself, such as an
+// identifier renamed or a literal edited, or replaced by a different kind of
+// node, at the ID of that node.
+//
+// Versions are compared by their printed source, ignoring layout and
+// comments. The merged file is a copy of ours, without free-floating
+// comments, and shares unchanged nodes with it; nodes taken from theirs are
+// copied without position information, so that they do not alias positions
+// in ours' FileSet. Since the merged file mixes nodes with and without
+// positions, print it with ours' FileSet and reformat the result (for
+// example with go/format.Source) where layout matters.
+func Merge(base, ours, theirs *ast.File) (*ast.File, []MergeConflict) {
+	return defaultConfig.Merge(base, ours, theirs)
+}
+
+// Merge is like the package-level Merge, computing IDs as configured by cfg.
+func (cfg *Config) Merge(base, ours, theirs *ast.File) (*ast.File, []MergeConflict) {
+	m := &merger{oursIds: cfg.Map(ours), theirsIds: cfg.Map(theirs)}
+	groups := make(map[string]string)
+	bases := declItems(base.Decls, groups)
+	for _, it := range bases {
+		if d, ok := it.node.(*ast.GenDecl); ok && d.Tok != token.IMPORT {
+			for _, name := range specNames(d) {
+				groups[d.Tok.String()+" "+name] = it.key
+			}
+		}
+	}
+	decls := m.mergeKeyed(bases, declItems(ours.Decls, groups), declItems(theirs.Decls, groups))
+
+	merged := *ours
+	merged.Decls = make([]ast.Decl, len(decls))
+	for i, d := range decls {
+		merged.Decls[i] = d.(ast.Decl)
+	}
+	merged.Comments = nil
+	return &merged, m.conflicts
+}
+
+type merger struct {
+	oursIds, theirsIds map[ast.Node]NodeId
+	conflicts          []MergeConflict
+}
+
+func (m *merger) conflict(ours, theirs ast.Node, reason string) {
+	id, ok := m.oursIds[ours]
+	if !ok {
+		id = m.theirsIds[theirs]
+	}
+	m.conflicts = append(m.conflicts, MergeConflict{id, reason})
+}
+
+// A mergeItem is a node in a list that is merged by key.
+type mergeItem struct {
+	key  string
+	node ast.Node
+}
+
+// declItems keys decls for mergeKeyed. groups maps the token and a name
+// declared by a group in base, such as "var x", to that group's key.
+func declItems(decls []ast.Decl, groups map[string]string) []mergeItem {
+	items := make([]mergeItem, len(decls))
+	for i, d := range decls {
+		items[i] = mergeItem{declKey(d, groups), d}
+	}
+	return withItemOrdinals(items)
+}
+
+func declKey(d ast.Decl, groups map[string]string) string {
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		return funcKey(d)
+	case *ast.GenDecl:
+		if d.Tok == token.IMPORT {
+			return "GenDecl:import"
+		}
+		names := specNames(d)
+		for _, name := range names {
+			if key, ok := groups[d.Tok.String()+" "+name]; ok {
+				return key
+			}
+		}
+		sort.Strings(names)
+		return "GenDecl:" + d.Tok.String() + ":" + strings.Join(names, ",")
+	}
+	return idComponent(d)
+}
+
+// specNames returns the names declared by the specs of d.
+func specNames(d *ast.GenDecl) []string {
+	var names []string
+	for _, s := range d.Specs {
+		switch s := s.(type) {
+		case *ast.ValueSpec:
+			for _, n := range s.Names {
+				names = append(names, n.Name)
+			}
+		case *ast.TypeSpec:
+			names = append(names, s.Name.Name)
+		}
+	}
+	return names
+}
+
+// withItemOrdinals makes the keys of items unique with withOrdinals, so
+// that every item is kept.
+func withItemOrdinals(items []mergeItem) []mergeItem {
+	keys := make([]string, len(items))
+	for i, it := range items {
+		keys[i] = it.key
+	}
+	for i, k := range withOrdinals(keys) {
+		items[i].key = k
+	}
+	return items
+}
+
+// mergeKeyed merges three versions of a list whose items are paired by key,
+// merging the items that both sides changed with mergeNode. The result has
+// the order of ours, with items added by theirs placed after the item that
+// precedes them in theirs.
+func (m *merger) mergeKeyed(base, ours, theirs []mergeItem) []ast.Node {
+	index := func(items []mergeItem) map[string]ast.Node {
+		nodes := make(map[string]ast.Node, len(items))
+		for _, it := range items {
+			if _, dup := nodes[it.key]; !dup {
+				nodes[it.key] = it.node
+			}
+		}
+		return nodes
+	}
+	bs, ous, ts := index(base), index(ours), index(theirs)
+	resolve := func(key string) ast.Node {
+		return m.mergeNode(bs[key], ous[key], ts[key])
+	}
+
+	var result []ast.Node
+	var keys []string
+	done := make(map[string]bool)
+	for _, it := range ours {
+		if done[it.key] {
+			continue
+		}
+		done[it.key] = true
+		if n := resolve(it.key); n != nil {
+			result = append(result, n)
+			keys = append(keys, it.key)
+		}
+	}
+	pos := 0
+	for _, it := range theirs {
+		if done[it.key] {
+			for i, k := range keys {
+				if k == it.key {
+					pos = i + 1
+				}
+			}
+			continue
+		}
+		done[it.key] = true
+		if n := resolve(it.key); n != nil {
+			result = append(result[:pos], append([]ast.Node{n}, result[pos:]...)...)
+			keys = append(keys[:pos], append([]string{it.key}, keys[pos:]...)...)
+			pos++
+		}
+	}
+	return result
+}
+
+var (
+	nodeType         = reflect.TypeOf((*ast.Node)(nil)).Elem()
+	commentGroupType = reflect.TypeOf((*ast.CommentGroup)(nil))
+)
+
+// mergeNode merges three versions of a node, any of which may be nil, and
+// returns the result, or nil if it was deleted. A node that only one side
+// changed takes that side's version. A node that both sides changed
+// differently is merged part by part: its children are paired by their ID
+// components, the children that both sides changed are merged in turn, and
+// a conflict is recorded only for a node whose own fields, such as a name
+// or operator, both sides changed differently, or whose children could not
+// be paired. Conflicting parts keep our version.
+func (m *merger) mergeNode(b, o, t ast.Node) ast.Node {
+	bt, ot, tt := mergeText(b), mergeText(o), mergeText(t)
+	switch {
+	case ot == tt || tt == bt:
+		return o
+	case ot == bt:
+		return copyNode(t)
+	case o == nil:
+		m.conflict(o, t, "deleted by ours, changed by theirs")
+		return copyNode(t)
+	case t == nil:
+		m.conflict(o, t, "changed by ours, deleted by theirs")
+		return o
+	case b == nil:
+		m.conflict(o, t, "added differently by both")
+		return o
+	case reflect.TypeOf(o) != reflect.TypeOf(b) || reflect.TypeOf(t) != reflect.TypeOf(b):
+		m.conflict(o, t, "changed by both")
+		return o
+	}
+
+	switch o := o.(type) {
+	case *ast.GenDecl:
+		bg, tg := b.(*ast.GenDecl), t.(*ast.GenDecl)
+		if bg.Tok != o.Tok || tg.Tok != o.Tok {
+			m.conflict(o, t, "changed by both")
+			return o
+		}
+		specItems := func(specs []ast.Spec) []mergeItem {
+			items := make([]mergeItem, len(specs))
+			for i, c := range specComponents(specs) {
+				items[i] = mergeItem{c, specs[i]}
+			}
+			return items
+		}
+		specs := m.mergeKeyed(specItems(bg.Specs), specItems(o.Specs), specItems(tg.Specs))
+		merged := *o
+		merged.Specs = make([]ast.Spec, len(specs))
+		for i, s := range specs {
+			merged.Specs[i] = s.(ast.Spec)
+		}
+		return &merged
+	case *ast.StructType:
+		merged := *o
+		merged.Fields = m.mergeFields(b.(*ast.StructType).Fields, o.Fields, t.(*ast.StructType).Fields)
+		return &merged
+	case *ast.InterfaceType:
+		merged := *o
+		merged.Methods = m.mergeFields(b.(*ast.InterfaceType).Methods, o.Methods, t.(*ast.InterfaceType).Methods)
+		return &merged
+	}
+
+	bv, ov, tv := reflect.ValueOf(b).Elem(), reflect.ValueOf(o).Elem(), reflect.ValueOf(t).Elem()
+	merged := reflect.New(ov.Type())
+	merged.Elem().Set(ov)
+	conflicted := false
+	for i := 0; i < ov.NumField(); i++ {
+		typ := ov.Type().Field(i).Type
+		if !ov.Type().Field(i).IsExported() || typ == posType || typ == objectType || typ == scopeType || typ == commentGroupType {
+			continue
+		}
+		bf, of, tf := bv.Field(i), ov.Field(i), tv.Field(i)
+		f := merged.Elem().Field(i)
+		switch {
+		case typ.Implements(nodeType):
+			if n := m.mergeNode(nodeValue(bf), nodeValue(of), nodeValue(tf)); n != nil {
+				f.Set(reflect.ValueOf(n))
+			} else {
+				f.Set(reflect.Zero(typ))
+			}
+		case typ.Kind() == reflect.Slice && typ.Elem().Implements(nodeType):
+			list := m.mergeList(nodeValues(bf), nodeValues(of), nodeValues(tf))
+			c := reflect.MakeSlice(typ, len(list), len(list))
+			for j, n := range list {
+				c.Index(j).Set(reflect.ValueOf(n))
+			}
+			f.Set(c)
+		case reflect.DeepEqual(of.Interface(), tf.Interface()), reflect.DeepEqual(tf.Interface(), bf.Interface()):
+		case reflect.DeepEqual(of.Interface(), bf.Interface()):
+			f.Set(tf)
+		default:
+			if !conflicted {
+				m.conflict(o, t, "changed by both")
+				conflicted = true
+			}
+		}
+	}
+	return merged.Interface().(ast.Node)
+}
+
+// mergeFields merges three versions of the fields of a struct or the
+// methods of an interface, which are paired by name, as their IDs are.
+func (m *merger) mergeFields(base, ours, theirs *ast.FieldList) *ast.FieldList {
+	fieldItems := func(list *ast.FieldList) []mergeItem {
+		items := make([]mergeItem, len(list.List))
+		for i, k := range fieldKeys(list, true) {
+			items[i] = mergeItem{k, list.List[i]}
+		}
+		return items
+	}
+	fields := m.mergeKeyed(fieldItems(base), fieldItems(ours), fieldItems(theirs))
+	merged := *ours
+	merged.List = make([]*ast.Field, len(fields))
+	for i, f := range fields {
+		merged.List[i] = f.(*ast.Field)
+	}
+	return &merged
+}
+
+// nodeValue returns the node held by v, or nil if v is a nil pointer or
+// interface.
+func nodeValue(v reflect.Value) ast.Node {
+	if v.IsNil() {
+		return nil
+	}
+	return v.Interface().(ast.Node)
+}
+
+func nodeValues(v reflect.Value) []ast.Node {
+	nodes := make([]ast.Node, v.Len())
+	for i := range nodes {
+		nodes[i] = nodeValue(v.Index(i))
+	}
+	return nodes
+}
+
+// mergeList merges three versions of a list of nodes, such as statements or
+// call arguments, with diff3: the items that both sides kept, by a longest
+// common subsequence of their printed source, split the lists into chunks.
+// In a chunk that both sides changed, items are paired by index, and so by
+// ID, if neither side added or removed any, and merged with mergeNode;
+// otherwise the chunk is a conflict.
+func (m *merger) mergeList(base, ours, theirs []ast.Node) []ast.Node {
+	texts := func(nodes []ast.Node) []string {
+		s := make([]string, len(nodes))
+		for i, x := range nodes {
+			s[i] = mergeText(x)
+		}
+		return s
+	}
+	bt, ot, tt := texts(base), texts(ours), texts(theirs)
+	mo, mt := lcsMatch(bt, ot), lcsMatch(bt, tt)
+
+	var result []ast.Node
+	ib, io, it := 0, 0, 0
+	for j := 0; j <= len(base); j++ {
+		if j < len(base) && (mo[j] < 0 || mt[j] < 0) {
+			continue
+		}
+		// base[ib:j], ours[io:oe] and theirs[it:te] are an unstable chunk,
+		// followed by base[j], which both sides kept.
+		oe, te := len(ours), len(theirs)
+		if j < len(base) {
+			oe, te = mo[j], mt[j]
+		}
+		switch {
+		case equalTexts(ot[io:oe], bt[ib:j]):
+			for _, x := range theirs[it:te] {
+				result = append(result, copyNode(x))
+			}
+		case equalTexts(tt[it:te], bt[ib:j]), equalTexts(ot[io:oe], tt[it:te]):
+			result = append(result, ours[io:oe]...)
+		case oe-io == j-ib && te-it == j-ib:
+			for k := 0; k < j-ib; k++ {
+				result = append(result, m.mergeNode(base[ib+k], ours[io+k], theirs[it+k]))
+			}
+		default:
+			var o, t ast.Node
+			if io < oe {
+				o = ours[io]
+			}
+			if it < te {
+				t = theirs[it]
+			}
+			m.conflict(o, t, "items added or removed by both")
+			result = append(result, ours[io:oe]...)
+		}
+		if j < len(base) {
+			result = append(result, ours[oe])
+		}
+		ib, io, it = j+1, oe+1, te+1
+	}
+	return result
+}
+
+// lcsMatch returns, for each element of a, the index of the element of b it
+// is paired with in a longest common subsequence of a and b, or -1.
+func lcsMatch(a, b []string) []int {
+	n := make([][]int, len(a)+1)
+	for i := range n {
+		n[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				n[i][j] = n[i+1][j+1] + 1
+			case n[i+1][j] >= n[i][j+1]:
+				n[i][j] = n[i+1][j]
+			default:
+				n[i][j] = n[i][j+1]
+			}
+		}
+	}
+	match := make([]int, len(a))
+	i, j := 0, 0
+	for i < len(a) {
+		switch {
+		case j < len(b) && a[i] == b[j]:
+			match[i] = j
+			i++
+			j++
+		case j < len(b) && n[i][j+1] > n[i+1][j]:
+			j++
+		default:
+			match[i] = -1
+			i++
+		}
+	}
+	return match
+}
+
+func equalTexts(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeText returns the normalized source of n that Merge compares, or ""
+// if n is nil. Fields, which the printer does not print on their own, are
+// printed as part of a struct type.
+func mergeText(n ast.Node) string {
+	switch x := n.(type) {
+	case nil:
+		return ""
+	case *ast.Field:
+		n = &ast.StructType{Fields: &ast.FieldList{List: []*ast.Field{x}}}
+	case *ast.FieldList:
+		n = &ast.StructType{Fields: x}
+	}
+	var b bytes.Buffer
+	if err := printer.Fprint(&b, hashFileSet, n); err != nil {
+		return fmt.Sprintf("%p", n)
+	}
+	return b.String()
+}
+
+var (
+	objectType = reflect.TypeOf((*ast.Object)(nil))
+	scopeType  = reflect.TypeOf((*ast.Scope)(nil))
+)
+
+// copyNode returns a deep copy of n without positions or object resolution,
+// or nil if n is nil.
+func copyNode(n ast.Node) ast.Node {
+	if n == nil {
+		return nil
+	}
+	return copyValue(reflect.ValueOf(n)).Interface().(ast.Node)
+}
+
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Type() == objectType || v.Type() == scopeType {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(copyValue(v.Elem()))
+		return c
+	case reflect.Interface:
+		c := reflect.New(v.Type()).Elem()
+		if !v.IsNil() {
+			c.Set(copyValue(v.Elem()))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() && v.Field(i).Type() != posType {
+				c.Field(i).Set(copyValue(v.Field(i)))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return c
+	}
+	return v
+}
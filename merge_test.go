@@ -0,0 +1,222 @@
+package idast
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"testing"
+)
+
+func parseMergeSrc(t *testing.T, fset *token.FileSet, name, src string) *ast.File {
+	file, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("Error parsing %s: %v", name, err)
+	}
+	return file
+}
+
+func TestMerge(t *testing.T) {
+	fset := token.NewFileSet()
+	base := parseMergeSrc(t, fset, "base.go", `package p
+
+import "fmt"
+
+func A() {
+	a1()
+	a2()
+	a3()
+}
+
+func B() {}
+`)
+	ours := parseMergeSrc(t, fset, "ours.go", `package p
+
+import "fmt"
+
+func A() {
+	a1()
+	ours()
+	a2()
+	a3()
+}
+
+func B() {}
+
+func C() {}
+`)
+	theirs := parseMergeSrc(t, fset, "theirs.go", `package p
+
+import (
+	"fmt"
+	"os"
+)
+
+func A() {
+	a1()
+	a2()
+	theirs()
+}
+
+func D() {}
+`)
+
+	merged, conflicts := Merge(base, ours, theirs)
+	if len(conflicts) != 0 {
+		t.Errorf("want no conflicts, got %v", conflicts)
+	}
+	want := parseMergeSrc(t, fset, "want.go", `package p
+
+import (
+	"fmt"
+	"os"
+)
+
+func A() {
+	a1()
+	ours()
+	a2()
+	theirs()
+}
+
+func D() {}
+
+func C() {}
+`)
+	if got, want := pretty(merged), pretty(want); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+
+	// The merged file is still printable with the original FileSet.
+	var b bytes.Buffer
+	if err := printer.Fprint(&b, fset, merged); err != nil {
+		t.Errorf("Error printing merged file: %v", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "merged.go", b.Bytes(), 0); err != nil {
+		t.Errorf("Error parsing printed merged file: %v\n%s", err, b.String())
+	}
+}
+
+func TestMergeConflicts(t *testing.T) {
+	fset := token.NewFileSet()
+	base := parseMergeSrc(t, fset, "base.go", "package p\nfunc A() {\n\ta(1)\n}\nfunc B() {}\nvar x = 1\n")
+	ours := parseMergeSrc(t, fset, "ours.go", "package p\nfunc A() {\n\ta(2)\n}\nvar x = 2\n")
+	theirs := parseMergeSrc(t, fset, "theirs.go", "package p\nfunc A() {\n\ta(3)\n}\nfunc B() { b() }\nvar x = 3\n")
+
+	merged, conflicts := Merge(base, ours, theirs)
+	want := []string{
+		"Decls/0/FuncDecl:A/Body/BlockStmt/List/0/ExprStmt/X/CallExpr/Args/0/BasicLit",
+		"Decls/1/GenDecl/Specs/ValueSpec:x/Values/0/BasicLit",
+		"Decls/1/FuncDecl:B",
+	}
+	if len(conflicts) != len(want) {
+		t.Fatalf("want %d conflicts, got %v", len(want), conflicts)
+	}
+	for i, c := range conflicts {
+		if c.Id.String() != want[i] {
+			t.Errorf("want conflict at %v, got %v (%s)", want[i], c.Id.String(), c.Reason)
+		}
+	}
+	if got := pretty(merged.Decls[0]); got != "func A() {\n\ta(2)\n}" {
+		t.Errorf("want our version of A kept, got:\n%s", got)
+	}
+}
+
+func TestMergeGroups(t *testing.T) {
+	fset := token.NewFileSet()
+	base := parseMergeSrc(t, fset, "base.go", "package p\nimport (\n\t\"fmt\"\n)\nvar (\n\tx = 1\n)\nfunc init() {}\nfunc init() {}\n")
+	ours := parseMergeSrc(t, fset, "ours.go", "package p\nimport (\n\t\"bytes\"\n\t\"fmt\"\n)\nvar (\n\tw = 0\n\tx = 1\n)\nfunc init() {}\nfunc init() {}\n")
+	theirs := parseMergeSrc(t, fset, "theirs.go", "package p\nimport (\n\t\"fmt\"\n\t\"os\"\n)\nvar (\n\tx = 1\n\ty = 2\n)\nfunc init() {}\nfunc init() { b() }\n")
+
+	merged, conflicts := Merge(base, ours, theirs)
+	if len(conflicts) != 0 {
+		t.Errorf("want no conflicts, got %v", conflicts)
+	}
+	want := parseMergeSrc(t, fset, "want.go", "package p\nimport (\n\t\"bytes\"\n\t\"fmt\"\n\t\"os\"\n)\nvar (\n\tw = 0\n\tx = 1\n\ty = 2\n)\nfunc init() {}\nfunc init() { b() }\n")
+	if got, want := pretty(merged), pretty(want); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestMergeNested(t *testing.T) {
+	fset := token.NewFileSet()
+	base := parseMergeSrc(t, fset, "base.go", `package p
+
+type T struct {
+	A int
+	B int
+}
+
+func A(ok bool) {
+	if ok {
+		a1()
+		a2()
+	}
+	f(1, 2)
+	g(1)
+}
+`)
+	ours := parseMergeSrc(t, fset, "ours.go", `package p
+
+type T struct {
+	B int
+	A int64
+}
+
+func A(ok bool) {
+	if ok {
+		ours()
+		a2()
+	}
+	f(10, 2)
+	g(2)
+}
+`)
+	theirs := parseMergeSrc(t, fset, "theirs.go", `package p
+
+type T struct {
+	A int
+	B string
+}
+
+func A(ok bool) {
+	if ok {
+		a1()
+		theirs()
+	}
+	f(1, 20)
+	g(3)
+}
+`)
+
+	merged, conflicts := Merge(base, ours, theirs)
+	want := []string{"Decls/1/FuncDecl:A/Body/BlockStmt/List/2/ExprStmt/X/CallExpr/Args/0/BasicLit"}
+	if len(conflicts) != len(want) {
+		t.Fatalf("want %d conflicts, got %v", len(want), conflicts)
+	}
+	for i, c := range conflicts {
+		if c.Id.String() != want[i] {
+			t.Errorf("want conflict at %v, got %v (%s)", want[i], c.Id.String(), c.Reason)
+		}
+	}
+	wantFile := parseMergeSrc(t, fset, "want.go", `package p
+
+type T struct {
+	B string
+	A int64
+}
+
+func A(ok bool) {
+	if ok {
+		ours()
+		theirs()
+	}
+	f(10, 20)
+	g(2)
+}
+`)
+	if got, want := pretty(merged), pretty(wantFile); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
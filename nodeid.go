@@ -16,6 +16,30 @@ func (nid *NodeId) String() string {
 	return strings.Join(*nid, "/")
 }
 
+// ParseNodeId parses the "/"-separated form of a NodeId returned by String.
+// Separators inside double-quoted strings, such as the import path in an
+// ImportSpec component, do not split components.
+func ParseNodeId(s string) NodeId {
+	if s == "" {
+		return NodeId{}
+	}
+	var nid NodeId
+	start, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == '/':
+			nid.push(s[start:i])
+			start = i + 1
+		}
+	}
+	nid.push(s[start:])
+	return nid
+}
+
 func (nid *NodeId) dup() NodeId {
 	newId := make(NodeId, len(*nid))
 	copy(newId, *nid)
@@ -36,3 +60,16 @@ func (nid *NodeId) pop() {
 func (nid *NodeId) pushed(c string) NodeId {
 	return append(nid.dup(), c)
 }
+
+// Reports whether the leading components of nid are those of prefix.
+func (nid *NodeId) hasPrefix(prefix NodeId) bool {
+	if len(*nid) < len(prefix) {
+		return false
+	}
+	for i, c := range prefix {
+		if (*nid)[i] != c {
+			return false
+		}
+	}
+	return true
+}
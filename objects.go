@@ -0,0 +1,51 @@
+package idast
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// An ObjectIndex ties the objects of a type-checked package to the IDs of
+// the identifiers that define and use them.
+type ObjectIndex struct {
+	// Ids maps each object defined in the package to the ID of its
+	// declaring identifier.
+	Ids map[types.Object]NodeId
+
+	// Objects maps the ID (as returned by NodeId.String) of each defining
+	// and using identifier to the object it denotes.
+	Objects map[string]types.Object
+}
+
+// IndexObjects builds an ObjectIndex for root, a file or package that has
+// been type-checked with the Defs and Uses of info recorded. Objects that
+// have no declaring identifier in root, such as those of other packages,
+// appear only in Objects.
+func IndexObjects(root ast.Node, info *types.Info) *ObjectIndex {
+	return defaultConfig.IndexObjects(root, info)
+}
+
+// IndexObjects is like the package-level IndexObjects, computing IDs as
+// configured by cfg.
+func (cfg *Config) IndexObjects(root ast.Node, info *types.Info) *ObjectIndex {
+	x := &ObjectIndex{
+		Ids:     make(map[types.Object]NodeId, len(info.Defs)),
+		Objects: make(map[string]types.Object, len(info.Defs)+len(info.Uses)),
+	}
+	m := cfg.Map(root)
+	for ident, obj := range info.Defs {
+		if obj == nil {
+			continue
+		}
+		if id, ok := m[ident]; ok {
+			x.Ids[obj] = id
+			x.Objects[id.String()] = obj
+		}
+	}
+	for ident, obj := range info.Uses {
+		if id, ok := m[ident]; ok {
+			x.Objects[id.String()] = obj
+		}
+	}
+	return x
+}
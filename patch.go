@@ -0,0 +1,344 @@
+package idast
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+)
+
+// The operations a patch hunk can perform on the node it targets.
+const (
+	PatchReplace      = "replace"
+	PatchDelete       = "delete"
+	PatchInsertBefore = "insert-before"
+	PatchInsertAfter  = "insert-after"
+)
+
+// A Hunk is one edit of a Patch: an operation on the node with a given ID
+// and, except for deletions, the Go source of the new node(s).
+type Hunk struct {
+	Op  string
+	Id  NodeId
+	Src string
+}
+
+// A Patch is a list of edits that target nodes by ID rather than by line
+// number. Its textual form is a sequence of hunks, each a header line
+//
+//	@@ <op> <id>
+//
+// followed by the lines of the hunk's source, if any:
+//
+//	@@ replace Decls/0/FuncDecl:A/Body/BlockStmt/List/0/ReturnStmt
+//	return 42
+//	@@ delete Decls/1/FuncDecl:B
+//
+// Source lines may not start with "@@ ".
+type Patch struct {
+	Hunks []Hunk
+}
+
+// ParsePatch parses the textual form of a patch.
+func ParsePatch(s string) (*Patch, error) {
+	p := &Patch{}
+	var src []string
+	flush := func() {
+		if len(p.Hunks) > 0 {
+			p.Hunks[len(p.Hunks)-1].Src = strings.Join(src, "\n")
+		}
+		src = nil
+	}
+	for i, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		if !strings.HasPrefix(line, "@@ ") {
+			if len(p.Hunks) == 0 {
+				if strings.TrimSpace(line) == "" {
+					continue
+				}
+				return nil, fmt.Errorf("idast: patch line %d: source before first hunk header", i+1)
+			}
+			src = append(src, line)
+			continue
+		}
+		flush()
+		fields := strings.Fields(line[3:])
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("idast: patch line %d: want \"@@ <op> <id>\", got %q", i+1, line)
+		}
+		switch fields[0] {
+		case PatchReplace, PatchDelete, PatchInsertBefore, PatchInsertAfter:
+		default:
+			return nil, fmt.Errorf("idast: patch line %d: unknown op %q", i+1, fields[0])
+		}
+		p.Hunks = append(p.Hunks, Hunk{Op: fields[0], Id: ParseNodeId(fields[1])})
+	}
+	flush()
+	return p, nil
+}
+
+// String returns the textual form of p.
+func (p *Patch) String() string {
+	var b strings.Builder
+	for _, h := range p.Hunks {
+		fmt.Fprintf(&b, "@@ %s %s\n", h.Op, h.Id.String())
+		if h.Src != "" {
+			b.WriteString(h.Src)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// A Conflict is a hunk that cannot be applied, and why.
+type Conflict struct {
+	Hunk   Hunk
+	Reason string
+}
+
+// A ConflictError is returned by ApplyPatch when some hunks cannot be
+// applied.
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	msgs := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		msgs[i] = fmt.Sprintf("%s %s: %s", c.Hunk.Op, c.Hunk.Id.String(), c.Reason)
+	}
+	return "idast: patch conflicts: " + strings.Join(msgs, "; ")
+}
+
+// ApplyPatch applies p to file. All hunks target the IDs of file as it was
+// before the patch. If any hunk's ID no longer resolves, its source does not
+// parse as the kind of node it targets or does not fit the field that holds
+// that node (such as a call in place of a name), or it conflicts with another
+// hunk, ApplyPatch returns a *ConflictError and leaves file unchanged.
+//
+// New nodes are parsed without position information, so that they are
+// formatted sensibly when file is printed.
+func ApplyPatch(file *ast.File, p *Patch) error {
+	return defaultConfig.ApplyPatch(file, p)
+}
+
+// ApplyPatch is like the package-level ApplyPatch, computing IDs as
+// configured by cfg.
+func (cfg *Config) ApplyPatch(file *ast.File, p *Patch) error {
+	// Resolve the targeted IDs to nodes and their parents.
+	type target struct {
+		node, parent ast.Node
+		slice        bool
+		typ          reflect.Type // of the slot holding node, if it has a parent
+	}
+	targets := make(map[string]*target, len(p.Hunks))
+	for _, h := range p.Hunks {
+		targets[h.Id.String()] = nil
+	}
+	cfg.Apply(file, func(c *Cursor) bool {
+		id := c.Id()
+		if _, ok := targets[id.String()]; ok {
+			t := &target{node: c.Node(), parent: c.Parent()}
+			if c.Parent() != nil {
+				s, _ := locate(c.Parent(), c.Node())
+				t.slice, t.typ = s.index >= 0, s.typ()
+			}
+			targets[id.String()] = t
+		}
+		return true
+	}, nil)
+
+	type edit struct {
+		replace  bool
+		with     ast.Node // nil to delete
+		before   []ast.Node
+		after    []ast.Node
+		replaced *Hunk
+	}
+	edits := make(map[ast.Node]*edit)
+	var conflicts []Conflict
+	for i := range p.Hunks {
+		h := &p.Hunks[i]
+		t := targets[h.Id.String()]
+		if t == nil {
+			conflicts = append(conflicts, Conflict{*h, "no node with this ID"})
+			continue
+		}
+		if r := enclosingRemoval(p, h); r != nil {
+			conflicts = append(conflicts, Conflict{*h, fmt.Sprintf("node is inside %s %s", r.Op, r.Id.String())})
+			continue
+		}
+		e := edits[t.node]
+		if e == nil {
+			e = &edit{}
+			edits[t.node] = e
+		}
+		if h.Op != PatchReplace && !t.slice {
+			conflicts = append(conflicts, Conflict{*h, fmt.Sprintf("%T is not in a list", t.node)})
+			continue
+		}
+		if h.Op == PatchReplace || h.Op == PatchDelete {
+			if e.replaced != nil {
+				conflicts = append(conflicts, Conflict{*h, fmt.Sprintf("node is also targeted by %s", e.replaced.Op)})
+				continue
+			}
+			e.replace, e.replaced = true, h
+			if h.Op == PatchDelete {
+				continue
+			}
+		}
+		nodes, err := parseLike(t.node, t.parent, h.Src)
+		if err == nil && h.Op == PatchReplace && len(nodes) != 1 {
+			err = fmt.Errorf("want 1 node, got %d", len(nodes))
+		}
+		for _, n := range nodes {
+			if err == nil && t.typ != nil && !reflect.TypeOf(n).AssignableTo(t.typ) {
+				err = fmt.Errorf("%T does not fit where %T is in %T", n, t.node, t.parent)
+			}
+		}
+		if err != nil {
+			conflicts = append(conflicts, Conflict{*h, err.Error()})
+			continue
+		}
+		switch h.Op {
+		case PatchReplace:
+			e.with = nodes[0]
+		case PatchInsertBefore:
+			e.before = append(e.before, nodes...)
+		case PatchInsertAfter:
+			e.after = append(e.after, nodes...)
+		}
+	}
+	if conflicts != nil {
+		return &ConflictError{conflicts}
+	}
+
+	cfg.Apply(file, func(c *Cursor) bool {
+		e := edits[c.Node()]
+		if e == nil {
+			return true
+		}
+		for _, n := range e.before {
+			c.InsertBefore(n)
+		}
+		for i := len(e.after) - 1; i >= 0; i-- {
+			c.InsertAfter(e.after[i])
+		}
+		switch {
+		case e.replace && e.with == nil:
+			c.Delete()
+		case e.replace:
+			c.Replace(e.with)
+		}
+		return !e.replace
+	}, nil)
+	return nil
+}
+
+// enclosingRemoval returns the hunk of p, if any, that replaces or deletes
+// an ancestor of the node targeted by h.
+func enclosingRemoval(p *Patch, h *Hunk) *Hunk {
+	for i := range p.Hunks {
+		r := &p.Hunks[i]
+		if (r.Op == PatchReplace || r.Op == PatchDelete) && len(h.Id) > len(r.Id) && h.Id.hasPrefix(r.Id) {
+			return r
+		}
+	}
+	return nil
+}
+
+// parseLike parses src as a list of nodes of the same kind as like, whose
+// parent is parent.
+func parseLike(like, parent ast.Node, src string) ([]ast.Node, error) {
+	fset := token.NewFileSet()
+	var nodes []ast.Node
+	switch like.(type) {
+	case ast.Expr:
+		x, err := parser.ParseExprFrom(fset, "", src, 0)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, x)
+
+	case ast.Stmt:
+		f, err := parser.ParseFile(fset, "", "package p; func _() {\n"+src+"\n}", 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range f.Decls[0].(*ast.FuncDecl).Body.List {
+			nodes = append(nodes, s)
+		}
+
+	case ast.Decl:
+		f, err := parser.ParseFile(fset, "", "package p\n"+src, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range f.Decls {
+			nodes = append(nodes, d)
+		}
+
+	case ast.Spec:
+		d, ok := parent.(*ast.GenDecl)
+		if !ok {
+			return nil, fmt.Errorf("%T is not in a declaration", like)
+		}
+		f, err := parser.ParseFile(fset, "", "package p\n"+d.Tok.String()+" (\n"+src+"\n)", 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range f.Decls[0].(*ast.GenDecl).Specs {
+			nodes = append(nodes, s)
+		}
+
+	case *ast.Field:
+		list, err := parseFields(fset, src)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range list.List {
+			nodes = append(nodes, f)
+		}
+
+	default:
+		return nil, fmt.Errorf("cannot patch %T", like)
+	}
+	for _, n := range nodes {
+		clearPositions(n)
+	}
+	return nodes, nil
+}
+
+// parseFields parses src as the fields of a struct or, failing that, the
+// methods of an interface. Parameters have the same syntax as struct
+// fields.
+func parseFields(fset *token.FileSet, src string) (*ast.FieldList, error) {
+	f, err := parser.ParseFile(fset, "", "package p\ntype _ struct {\n"+src+"\n}", 0)
+	if err == nil {
+		return f.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(*ast.StructType).Fields, nil
+	}
+	f, ierr := parser.ParseFile(fset, "", "package p\ntype _ interface {\n"+src+"\n}", 0)
+	if ierr != nil {
+		return nil, err
+	}
+	return f.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(*ast.InterfaceType).Methods, nil
+}
+
+var posType = reflect.TypeOf(token.NoPos)
+
+// clearPositions sets all positions in the tree rooted at n to token.NoPos.
+func clearPositions(n ast.Node) {
+	ast.Inspect(n, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		v := reflect.ValueOf(n).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.Type() == posType && f.CanSet() {
+				f.SetInt(int64(token.NoPos))
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,161 @@
+package idast
+
+import (
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const patchSrc = `package p
+
+import "fmt"
+
+func A() int {
+	fmt.Println("a")
+	return 1
+}
+
+func B() {}
+`
+
+func TestApplyPatch(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", patchSrc, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+
+	p, err := ParsePatch(`
+@@ replace Decls/1/FuncDecl:A/Body/BlockStmt/List/1/ReturnStmt/Results/0/BasicLit
+42
+@@ insert-after Decls/1/FuncDecl:A/Body/BlockStmt/List/0/ExprStmt
+x := 1
+_ = x
+@@ delete Decls/2/FuncDecl:B
+@@ insert-after Decls/0/GenDecl/Specs/ImportSpec:"fmt"
+"os"
+`)
+	if err != nil {
+		t.Fatalf("ParsePatch: %v", err)
+	}
+	if err := ApplyPatch(file, p); err != nil {
+		t.Fatalf("ApplyPatch: %v", err)
+	}
+
+	var b bytes.Buffer
+	printer.Fprint(&b, fset, file)
+	want := `package p
+
+import (
+	"fmt"
+	"os"
+)
+
+func A() int {
+	fmt.Println("a")
+	x := 1
+	_ = x
+	return 42
+}
+`
+	if got := b.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestApplyPatchFields(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", "package p\n\ntype T struct {\n\tA int\n\tB string\n\tC bool\n}\n", 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	var ids []string
+	for n, id := range Map(file) {
+		if _, ok := n.(*ast.Field); ok {
+			ids = append(ids, id.String())
+		}
+	}
+	sort.Strings(ids)
+	const fields = "Decls/0/GenDecl/Specs/TypeSpec:T/Type/StructType/Fields/FieldList/List/"
+	if want := []string{fields + "A/Field", fields + "B/Field", fields + "C/Field"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("want field IDs %v, got %v", want, ids)
+	}
+
+	p, err := ParsePatch("@@ replace " + ids[0] + "\nA int64\n@@ delete " + ids[1] + "\n")
+	if err != nil {
+		t.Fatalf("ParsePatch: %v", err)
+	}
+	if err := ApplyPatch(file, p); err != nil {
+		t.Fatalf("ApplyPatch: %v", err)
+	}
+	want := "type T struct {\n\tA\tint64\n\tC\tbool\n}"
+	if got := pretty(file.Decls[0]); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestApplyPatchConflicts(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", patchSrc, 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	before := pretty(file)
+
+	p := &Patch{Hunks: []Hunk{
+		{Op: PatchReplace, Id: ParseNodeId("Decls/1/FuncDecl:A/Body/BlockStmt/List/1/ReturnStmt"), Src: "return 2"},
+		{Op: PatchDelete, Id: ParseNodeId("Decls/9/FuncDecl:C")},
+		{Op: PatchDelete, Id: ParseNodeId("Decls/1/FuncDecl:A/Body/BlockStmt/List/1/ReturnStmt")},
+		{Op: PatchReplace, Id: ParseNodeId("Decls/1/FuncDecl:A/Body/BlockStmt/List/1/ReturnStmt/Results/0/BasicLit"), Src: "3"},
+		{Op: PatchInsertAfter, Id: ParseNodeId("Decls/1/FuncDecl:A/Name/Ident"), Src: "x"},
+		{Op: PatchReplace, Id: ParseNodeId("Decls/2/FuncDecl:B/Body/BlockStmt"), Src: "{ )"},
+	}}
+	err = ApplyPatch(file, p)
+	var ce *ConflictError
+	if !errors.As(err, &ce) {
+		t.Fatalf("want *ConflictError, got %v", err)
+	}
+	if len(ce.Conflicts) != 5 {
+		t.Errorf("want 5 conflicts, got %v", err)
+	}
+	if after := pretty(file); after != before {
+		t.Errorf("want file unchanged, got:\n%s", after)
+	}
+
+	// Hunks that parse but don't fit the field they target.
+	for _, h := range []Hunk{
+		{Op: PatchReplace, Id: ParseNodeId("Decls/1/FuncDecl:A/Name/Ident"), Src: "foo()"},
+		{Op: PatchReplace, Id: ParseNodeId("Decls/2/FuncDecl:B/Body/BlockStmt"), Src: "return"},
+	} {
+		err := ApplyPatch(file, &Patch{Hunks: []Hunk{h}})
+		if !errors.As(err, &ce) || len(ce.Conflicts) != 1 {
+			t.Errorf("%s %s: want 1 conflict, got %v", h.Op, h.Id.String(), err)
+		}
+	}
+	if after := pretty(file); after != before {
+		t.Errorf("want file unchanged, got:\n%s", after)
+	}
+}
+
+func TestPatchString(t *testing.T) {
+	s := "@@ replace Decls/0/FuncDecl:A/Body/BlockStmt\n{\n\treturn\n}\n@@ delete Decls/1/FuncDecl:B\n"
+	p, err := ParsePatch(s)
+	if err != nil {
+		t.Fatalf("ParsePatch: %v", err)
+	}
+	if got := p.String(); got != s {
+		t.Errorf("want:\n%s\ngot:\n%s", s, got)
+	}
+
+	for _, s := range []string{"return\n", "@@ frob Decls/0\n", "@@ delete\n"} {
+		if _, err := ParsePatch(s); err == nil {
+			t.Errorf("ParsePatch(%q): want error", s)
+		}
+	}
+}
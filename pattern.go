@@ -0,0 +1,61 @@
+package idast
+
+import (
+	"fmt"
+)
+
+// A Pattern is a compiled glob pattern over IDs. Its syntax is that of
+// NodeId.String, except that a "*" within a component matches any run of
+// characters, a "?" matches any single character, and a component that is
+// exactly "**" matches any number (including zero) of components:
+//
+//	Decls/*/FuncDecl:Test*/**
+//
+// Patterns are the subset of queries (see Query) without predicates.
+type Pattern struct {
+	src   string
+	steps []queryStep
+}
+
+// CompilePattern compiles the pattern s.
+func CompilePattern(s string) (*Pattern, error) {
+	p := &Pattern{src: s}
+	for _, c := range ParseNodeId(s) {
+		if c == "" {
+			return nil, fmt.Errorf("idast: bad pattern %q: empty component", s)
+		}
+		p.steps = append(p.steps, queryStep{any: c == "**", glob: c})
+	}
+	return p, nil
+}
+
+// MustCompilePattern is like CompilePattern but panics if s is not a valid
+// pattern.
+func MustCompilePattern(s string) *Pattern {
+	p, err := CompilePattern(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Match reports whether id matches p.
+func (p *Pattern) Match(id NodeId) bool {
+	return matchSteps(p.steps, id, 0, func(*queryStep, int) bool { return true })
+}
+
+// String returns the source text of p.
+func (p *Pattern) String() string {
+	return p.src
+}
+
+// Match reports whether id matches pattern. It returns false if pattern is
+// not a valid pattern; use CompilePattern to check patterns and to avoid
+// recompiling them.
+func Match(pattern string, id NodeId) bool {
+	p, err := CompilePattern(pattern)
+	if err != nil {
+		return false
+	}
+	return p.Match(id)
+}
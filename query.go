@@ -0,0 +1,311 @@
+package idast
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Query selects nodes by their IDs. Its syntax is a "/"-separated path of
+// steps, each of which matches one ID component, like NodeId.String:
+//
+//	**/FuncDecl:Test*/Body/**/CallExpr[Fun=t.Fatal]
+//
+// A step is either "**", which matches any number (including zero) of
+// components, or a pattern in which "*" matches any run of characters and
+// "?" matches any single character. A pattern may be followed by predicates
+// on the node whose ID ends at that component, in brackets and separated by
+// commas:
+//
+//	[Field=pattern]  the field's value matches pattern
+//	[Field!=pattern] the field's value does not match pattern
+//	[Field]          the field is set (not nil, zero or empty)
+//
+// Field is the name of a field of the node's struct type, such as Fun or
+// Name. Node-valued fields are compared by their printed source, so that
+// [Fun=t.Fatal] matches calls of t.Fatal. Patterns in predicates may be
+// double-quoted to include ",", "]" or "/".
+type Query struct {
+	steps []queryStep
+}
+
+type queryStep struct {
+	any   bool // "**"
+	glob  string
+	preds []queryPred
+}
+
+type queryPred struct {
+	field string
+	op    string // "=", "!=" or "" (presence)
+	glob  string
+}
+
+// ParseQuery parses a query in the syntax described at Query.
+func ParseQuery(s string) (*Query, error) {
+	parts, err := splitQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	q := &Query{}
+	for _, part := range parts {
+		step, err := parseQueryStep(part)
+		if err != nil {
+			return nil, fmt.Errorf("idast: bad query %q: %v", s, err)
+		}
+		q.steps = append(q.steps, step)
+	}
+	return q, nil
+}
+
+// splitQuery splits s into steps at the "/"s that are outside brackets and
+// quotes.
+func splitQuery(s string) ([]string, error) {
+	var parts []string
+	start, depth, quoted := 0, 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '[':
+			depth++
+		case c == ']':
+			if depth--; depth < 0 {
+				return nil, fmt.Errorf("idast: bad query %q: unexpected ']'", s)
+			}
+		case c == '/' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	if quoted || depth != 0 {
+		return nil, fmt.Errorf("idast: bad query %q: unterminated quote or bracket", s)
+	}
+	return append(parts, s[start:]), nil
+}
+
+func parseQueryStep(s string) (queryStep, error) {
+	if s == "**" {
+		return queryStep{any: true}, nil
+	}
+	i := strings.Index(s, "[")
+	if i == -1 {
+		i = len(s)
+	}
+	step := queryStep{glob: s[:i]}
+	if step.glob == "" {
+		return step, errors.New("empty step")
+	}
+	for rest := s[i:]; rest != ""; {
+		if rest[0] != '[' {
+			return step, fmt.Errorf("unexpected %q after predicate", rest)
+		}
+		end := closingBracket(rest)
+		if end == -1 {
+			return step, errors.New("unterminated predicate")
+		}
+		for _, p := range splitOutsideQuotes(rest[1:end], ',') {
+			pred, err := parseQueryPred(p)
+			if err != nil {
+				return step, err
+			}
+			step.preds = append(step.preds, pred)
+		}
+		rest = rest[end+1:]
+	}
+	return step, nil
+}
+
+// closingBracket returns the index of the "]" that closes the "[" at the
+// start of s, or -1.
+func closingBracket(s string) int {
+	quoted := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	start, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func parseQueryPred(s string) (queryPred, error) {
+	var pred queryPred
+	i := strings.Index(s, "=")
+	if i == -1 {
+		pred.field = strings.TrimSpace(s)
+	} else {
+		pred.field, pred.op, pred.glob = s[:i], "=", strings.TrimSpace(s[i+1:])
+		if strings.HasSuffix(pred.field, "!") {
+			pred.field, pred.op = pred.field[:len(pred.field)-1], "!="
+		}
+		pred.field = strings.TrimSpace(pred.field)
+		if strings.HasPrefix(pred.glob, `"`) {
+			unquoted, err := strconv.Unquote(pred.glob)
+			if err != nil {
+				return pred, fmt.Errorf("bad quoted pattern %s", pred.glob)
+			}
+			pred.glob = unquoted
+		}
+	}
+	if pred.field == "" {
+		return pred, fmt.Errorf("predicate %q has no field", s)
+	}
+	return pred, nil
+}
+
+// Eval returns the nodes in index, as returned by Map, that match q, sorted
+// by ID.
+func (q *Query) Eval(index map[ast.Node]NodeId) []NodeWithId {
+	byId := make(map[string]ast.Node, len(index))
+	for n, id := range index {
+		byId[id.String()] = n
+	}
+	var nodes []NodeWithId
+	for n, id := range index {
+		if q.match(id, byId) {
+			nodes = append(nodes, NodeWithId{n, id})
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Id.String() < nodes[j].Id.String()
+	})
+	return nodes
+}
+
+// match reports whether id matches q. byId looks up the nodes that
+// predicates apply to.
+func (q *Query) match(id NodeId, byId map[string]ast.Node) bool {
+	return matchSteps(q.steps, id, 0, func(step *queryStep, k int) bool {
+		if len(step.preds) == 0 {
+			return true
+		}
+		n := byId[strings.Join(id[:k+1], "/")]
+		for _, pred := range step.preds {
+			if n == nil || !pred.match(n) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// matchSteps reports whether id[k:] matches steps. Each component matched by
+// a pattern step must also satisfy check.
+func matchSteps(steps []queryStep, id NodeId, k int, check func(step *queryStep, k int) bool) bool {
+	if len(steps) == 0 {
+		return k == len(id)
+	}
+	step := &steps[0]
+	if step.any {
+		for j := k; j <= len(id); j++ {
+			if matchSteps(steps[1:], id, j, check) {
+				return true
+			}
+		}
+		return false
+	}
+	return k < len(id) && globMatch(step.glob, id[k]) && check(step, k) && matchSteps(steps[1:], id, k+1, check)
+}
+
+// globMatch reports whether s matches pattern, in which "*" matches any run
+// of characters and "?" matches any single character.
+func globMatch(pattern, s string) bool {
+	star, resume := -1, 0
+	for i, j := 0, 0; j < len(s); {
+		switch {
+		case i < len(pattern) && (pattern[i] == '?' || pattern[i] == s[j]):
+			i++
+			j++
+		case i < len(pattern) && pattern[i] == '*':
+			star, resume = i, j
+			i++
+		case star != -1:
+			resume++
+			i, j = star+1, resume
+		default:
+			return false
+		}
+		if j == len(s) {
+			for i < len(pattern) && pattern[i] == '*' {
+				i++
+			}
+			return i == len(pattern)
+		}
+	}
+	return strings.Trim(pattern, "*") == ""
+}
+
+func (pred *queryPred) match(n ast.Node) bool {
+	v := reflect.ValueOf(n)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+	f := v.FieldByName(pred.field)
+	if !f.IsValid() {
+		return false
+	}
+	switch pred.op {
+	case "=":
+		return globMatch(pred.glob, fieldText(f))
+	case "!=":
+		return !globMatch(pred.glob, fieldText(f))
+	}
+	return !f.IsZero() && !(f.Kind() == reflect.Slice && f.Len() == 0)
+}
+
+// queryFileSet is empty, so that nodes are printed without their original
+// layout.
+var queryFileSet = token.NewFileSet()
+
+// fieldText returns the text that predicates compare the field value f with.
+func fieldText(f reflect.Value) string {
+	if f.Kind() == reflect.Interface || f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			return ""
+		}
+		if n, ok := f.Interface().(ast.Node); ok {
+			var b bytes.Buffer
+			printer.Fprint(&b, queryFileSet, n)
+			return b.String()
+		}
+	}
+	if s, ok := f.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprint(f.Interface())
+}
@@ -0,0 +1,137 @@
+package idast
+
+import (
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	src := `package p
+
+import "testing"
+
+func TestA(t *testing.T) {
+	if false {
+		t.Fatal("a")
+	}
+	t.Log("b")
+}
+
+func helper(t *testing.T) {
+	t.Fatal("c")
+}
+`
+	file, err := parser.ParseFile(token.NewFileSet(), "p_test.go", src, 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	index := Map(file)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{
+			"**/FuncDecl:Test*/Body/**/CallExpr[Fun=t.Fatal]",
+			[]string{"Decls/1/FuncDecl:TestA/Body/BlockStmt/List/0/IfStmt/Body/BlockStmt/List/0/ExprStmt/X/CallExpr"},
+		},
+		{
+			"**/CallExpr[Fun=t.*,Args]",
+			[]string{
+				"Decls/1/FuncDecl:TestA/Body/BlockStmt/List/0/IfStmt/Body/BlockStmt/List/0/ExprStmt/X/CallExpr",
+				"Decls/1/FuncDecl:TestA/Body/BlockStmt/List/1/ExprStmt/X/CallExpr",
+				"Decls/2/FuncDecl:helper/Body/BlockStmt/List/0/ExprStmt/X/CallExpr",
+			},
+		},
+		{
+			"Decls/*/FuncDecl:*[Name!=Test*]",
+			[]string{"Decls/2/FuncDecl:helper"},
+		},
+		{
+			`Decls/0/GenDecl/Specs/ImportSpec:*[Path="\"testing\""]`,
+			[]string{`Decls/0/GenDecl/Specs/ImportSpec:"testing"`},
+		},
+		{
+			`Decls/2/**/BasicLit[Kind=STRING,Value="\"?\""]`,
+			[]string{"Decls/2/FuncDecl:helper/Body/BlockStmt/List/0/ExprStmt/X/CallExpr/Args/0/BasicLit"},
+		},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", test.query, err)
+			continue
+		}
+		var got []string
+		for _, n := range q.Eval(index) {
+			got = append(got, n.Id.String())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: want %v, got %v", test.query, test.want, got)
+		}
+	}
+
+	for _, s := range []string{"a//b", "a[b", "a]b", "a[=x]", "a[b]c", `a[b="]`} {
+		if _, err := ParseQuery(s); err == nil {
+			t.Errorf("ParseQuery(%q): want error", s)
+		}
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"", "", true},
+		{"*", "", true},
+		{"*", "abc", true},
+		{"a*c", "abbc", true},
+		{"a*c", "abcd", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"*b*", "abc", true},
+		{"FuncDecl:Test*", "FuncDecl:TestA", true},
+		{"FuncDecl:Test*", "FuncDecl:helper", false},
+	}
+	for _, test := range tests {
+		if got := globMatch(test.pattern, test.s); got != test.want {
+			t.Errorf("globMatch(%q, %q): want %v, got %v", test.pattern, test.s, test.want, got)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	id := ParseNodeId(`Decls/0/GenDecl/Specs/ImportSpec:"net/http"/Path/BasicLit`)
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"**", true},
+		{"Decls/**", true},
+		{"Decls/*/GenDecl/**", true},
+		{"Decls/*/FuncDecl:*/**", false},
+		{`**/ImportSpec:"net/http"/**`, true},
+		{`**/ImportSpec:"net/*"/Path/BasicLit`, true},
+		{"**/Path/BasicLit", true},
+		{"**/Path", false},
+		{"Decls/*/GenDecl/Specs/*/*/*", true},
+		{"Decls/*/GenDecl/Specs/*/*", false},
+		{"Decls/0/**/**/BasicLit", true},
+		{"Decls//GenDecl/**", false},
+	}
+	for _, test := range tests {
+		if got := Match(test.pattern, id); got != test.want {
+			t.Errorf("Match(%q, %v): want %v, got %v", test.pattern, id.String(), test.want, got)
+		}
+	}
+
+	if _, err := CompilePattern("a//b"); err == nil {
+		t.Errorf("CompilePattern(%q): want error", "a//b")
+	}
+	if p := MustCompilePattern("Decls/**"); p.String() != "Decls/**" || !p.Match(NodeId{"Decls", "0"}) {
+		t.Errorf("want compiled pattern Decls/** to match Decls/0")
+	}
+}
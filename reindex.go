@@ -0,0 +1,91 @@
+package idast
+
+import (
+	"errors"
+	"go/ast"
+	"strconv"
+)
+
+// Reindex updates index, as returned by Map, after the top-level declaration
+// changed has been added to file or replaced in file.Decls. Entries for the
+// declaration it replaced (and for any other declarations no longer in file)
+// are removed, and only the changed declaration is walked again. When adding
+// or removing declarations shifts the positional IDs of the other
+// declarations, their entries are renamed in place rather than recomputed.
+//
+// The index may have been built from file or from a package containing it;
+// file itself must be in the index.
+func Reindex(index map[ast.Node]NodeId, file *ast.File, changed ast.Decl) error {
+	return defaultConfig.Reindex(index, file, changed)
+}
+
+// Reindex is like the package-level Reindex, for an index built with
+// cfg.Map.
+func (cfg *Config) Reindex(index map[ast.Node]NodeId, file *ast.File, changed ast.Decl) error {
+	fileId, ok := index[file]
+	if !ok {
+		return errors.New("idast.Reindex: file is not in index")
+	}
+	pos := -1
+	for i, d := range file.Decls {
+		if d == changed {
+			pos = i
+			break
+		}
+	}
+	if pos == -1 {
+		return errors.New("idast.Reindex: changed is not a declaration in file")
+	}
+
+	declsId := fileId.pushed("Decls")
+	declIdLen := len(declsId) + 2
+
+	// Work out where each surviving declaration's entries now belong, keyed by
+	// the declaration's old ID. Declarations missing from the index are
+	// walked along with changed.
+	moved := make(map[string]NodeId)
+	kept := make(map[string]bool)
+	walkDecls := []int{pos}
+	for i, d := range file.Decls {
+		if i == pos {
+			continue
+		}
+		oldId, ok := index[d]
+		if !ok {
+			walkDecls = append(walkDecls, i)
+			continue
+		}
+		newId := declsId.pushed(strconv.Itoa(i))
+		newId.push(idComponent(d))
+		if s := oldId.String(); s != newId.String() {
+			moved[s] = newId
+		} else {
+			kept[s] = true
+		}
+	}
+
+	for n, id := range index {
+		if len(id) < declIdLen || !id.hasPrefix(declsId) {
+			continue
+		}
+		declId := id[:declIdLen]
+		if kept[declId.String()] {
+			continue
+		}
+		if newId, ok := moved[declId.String()]; ok {
+			index[n] = append(newId.dup(), id[declIdLen:]...)
+		} else {
+			delete(index, n)
+		}
+	}
+
+	for _, i := range walkDecls {
+		cfg.WalkFrom(inspector(func(n ast.Node, id NodeId) bool {
+			if n != nil {
+				index[n] = id.dup()
+			}
+			return true
+		}), file.Decls[i], declsId.pushed(strconv.Itoa(i)))
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package idast
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+)
+
+// LocalIds returns symbol-like IDs for the functions, closures and
+// function-local declarations in node. Rather than the full path through the
+// syntax tree, each ID is the path through the enclosing declaration scopes,
+// such as "FuncDecl:A/func#2/var:x" for the variable x declared in the second
+// function literal in A.
+//
+// The map contains the *ast.FuncDecl and *ast.FuncLit nodes (labelled
+// "FuncDecl:<name>", "FuncDecl:<receiver type>.<name>" for methods, and
+// "func#<n>"), and the defining *ast.Ident of each
+// parameter and result ("param:<name>") and each local variable, constant and
+// type ("var:<name>", "const:<name>" and "type:<name>"). When a label occurs
+// more than once in the same scope, later occurrences get an ordinal suffix,
+// as in "var:x#2". Package-level variables, constants and types are not
+// included; blank identifiers are skipped.
+func LocalIds(node ast.Node) map[ast.Node]NodeId {
+	m := make(map[ast.Node]NodeId)
+	scopes := []*localScope{newLocalScope(nil)}
+	var stack []ast.Node
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == nil {
+			switch stack[len(stack)-1].(type) {
+			case *ast.FuncDecl, *ast.FuncLit:
+				scopes = scopes[:len(scopes)-1]
+			}
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, n)
+
+		s := scopes[len(scopes)-1]
+		local := len(scopes) > 1
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			m[n] = s.label(funcKey(n), false)
+			fs := newLocalScope(m[n])
+			fs.declareFields(m, n.Recv)
+			fs.declareFields(m, n.Type.Params)
+			fs.declareFields(m, n.Type.Results)
+			scopes = append(scopes, fs)
+
+		case *ast.FuncLit:
+			m[n] = s.label("func", true)
+			fs := newLocalScope(m[n])
+			fs.declareFields(m, n.Type.Params)
+			fs.declareFields(m, n.Type.Results)
+			scopes = append(scopes, fs)
+
+		case *ast.AssignStmt:
+			if local && n.Tok == token.DEFINE {
+				for _, x := range n.Lhs {
+					s.declareDefined(m, x, n)
+				}
+			}
+
+		case *ast.RangeStmt:
+			// Both range variables are always new; the resolver records a
+			// synthesized statement as their declaration.
+			if local && n.Tok == token.DEFINE {
+				for _, x := range []ast.Expr{n.Key, n.Value} {
+					if name, ok := x.(*ast.Ident); ok {
+						s.declare(m, "var", name)
+					}
+				}
+			}
+
+		case *ast.ValueSpec:
+			if local {
+				kind := "var"
+				if d, ok := stack[len(stack)-2].(*ast.GenDecl); ok && d.Tok == token.CONST {
+					kind = "const"
+				}
+				for _, name := range n.Names {
+					s.declare(m, kind, name)
+				}
+			}
+
+		case *ast.TypeSpec:
+			if local {
+				s.declare(m, "type", n.Name)
+			}
+		}
+		return true
+	})
+	return m
+}
+
+// A localScope is a function or closure (or, at the root, the package) in
+// which LocalIds labels declarations.
+type localScope struct {
+	id     NodeId
+	counts map[string]int
+}
+
+func newLocalScope(id NodeId) *localScope {
+	return &localScope{id: id, counts: make(map[string]int)}
+}
+
+// label returns the ID for the next occurrence of label in s. If ordinal is
+// true, the ordinal suffix is added even to the first occurrence.
+func (s *localScope) label(label string, ordinal bool) NodeId {
+	s.counts[label]++
+	if n := s.counts[label]; ordinal || n > 1 {
+		label += "#" + strconv.Itoa(n)
+	}
+	return s.id.pushed(label)
+}
+
+func (s *localScope) declare(m map[ast.Node]NodeId, kind string, name *ast.Ident) {
+	if name.Name != "_" {
+		m[name] = s.label(kind+":"+name.Name, false)
+	}
+}
+
+func (s *localScope) declareFields(m map[ast.Node]NodeId, fields *ast.FieldList) {
+	if fields == nil {
+		return
+	}
+	for _, f := range fields.List {
+		for _, name := range f.Names {
+			s.declare(m, "param", name)
+		}
+	}
+}
+
+// declareDefined declares x if it is an identifier that is newly defined by
+// the := in stmt, as opposed to one that is merely assigned to. Without
+// object resolution every identifier on the left is assumed to be new.
+func (s *localScope) declareDefined(m map[ast.Node]NodeId, x ast.Expr, stmt ast.Stmt) {
+	name, ok := x.(*ast.Ident)
+	if !ok {
+		return
+	}
+	if name.Obj != nil && name.Obj.Decl != stmt {
+		return
+	}
+	s.declare(m, "var", name)
+}
@@ -0,0 +1,168 @@
+package idast
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WriteTags writes to w a tags file, in the extended format of Universal
+// Ctags, for the package-level declarations in root, which must be a file or
+// package parsed into fset. There is a tag for each function, method, type,
+// var and const, and for each field and method of a struct or interface
+// type. Tags are addressed by line number, in the file named in fset, and
+// carry the ID of the declaring node in a "nodeid" field:
+//
+//	A	a.go	3;"	f	nodeid:Decls/0/FuncDecl:A
+//	M	a.go	8;"	f	struct:T	nodeid:Decls/2/FuncDecl:M
+func WriteTags(w io.Writer, fset *token.FileSet, root ast.Node) error {
+	return defaultConfig.WriteTags(w, fset, root)
+}
+
+// WriteTags is like the package-level WriteTags, computing IDs as configured
+// by cfg.
+func (cfg *Config) WriteTags(w io.Writer, fset *token.FileSet, root ast.Node) error {
+	var files []*ast.File
+	switch r := root.(type) {
+	case *ast.File:
+		files = []*ast.File{r}
+	case *ast.Package:
+		for _, f := range r.Files {
+			files = append(files, f)
+		}
+	default:
+		return fmt.Errorf("idast.WriteTags: root is a %T, not a file or package", root)
+	}
+
+	type tag struct {
+		name  string
+		pos   token.Position
+		kind  string
+		scope string
+		id    NodeId
+	}
+	var tags []tag
+	ids := cfg.Map(root)
+	// Positions ignore //line directives, so that tags point into the files
+	// as written.
+	add := func(name string, pos token.Pos, kind, scope string, n ast.Node) {
+		if name == "" || name == "_" {
+			return
+		}
+		tags = append(tags, tag{name, fset.PositionFor(pos, false), kind, scope, ids[n]})
+	}
+
+	// Receiver base types, for scoping methods.
+	kinds := make(map[string]string)
+	for _, f := range files {
+		for _, d := range f.Decls {
+			if d, ok := d.(*ast.GenDecl); ok && d.Tok == token.TYPE {
+				for _, s := range d.Specs {
+					s := s.(*ast.TypeSpec)
+					kinds[s.Name.Name] = typeScope(s)
+				}
+			}
+		}
+	}
+
+	for _, f := range files {
+		for _, d := range f.Decls {
+			switch d := d.(type) {
+			case *ast.FuncDecl:
+				scope := ""
+				if d.Recv != nil && len(d.Recv.List) > 0 {
+					recv := embeddedName(d.Recv.List[0].Type)
+					kind := kinds[recv]
+					if kind == "" {
+						kind = "type"
+					}
+					scope = kind + ":" + recv
+				}
+				add(d.Name.Name, d.Name.Pos(), "f", scope, d)
+			case *ast.GenDecl:
+				for _, s := range d.Specs {
+					switch s := s.(type) {
+					case *ast.ValueSpec:
+						kind := "v"
+						if d.Tok == token.CONST {
+							kind = "c"
+						}
+						for _, name := range s.Names {
+							add(name.Name, name.Pos(), kind, "", s)
+						}
+					case *ast.TypeSpec:
+						scope := typeScope(s) + ":" + s.Name.Name
+						switch t := s.Type.(type) {
+						case *ast.StructType:
+							add(s.Name.Name, s.Name.Pos(), "s", "", s)
+							for _, field := range t.Fields.List {
+								if len(field.Names) == 0 {
+									add(embeddedName(field.Type), field.Type.Pos(), "M", scope, field)
+								}
+								for _, name := range field.Names {
+									add(name.Name, name.Pos(), "m", scope, field)
+								}
+							}
+						case *ast.InterfaceType:
+							add(s.Name.Name, s.Name.Pos(), "i", "", s)
+							for _, field := range t.Methods.List {
+								for _, name := range field.Names {
+									add(name.Name, name.Pos(), "n", scope, field)
+								}
+							}
+						default:
+							kind := "t"
+							if s.Assign.IsValid() {
+								kind = "a"
+							}
+							add(s.Name.Name, s.Name.Pos(), kind, "", s)
+						}
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		a, b := tags[i], tags[j]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if a.pos.Filename != b.pos.Filename {
+			return a.pos.Filename < b.pos.Filename
+		}
+		return a.pos.Offset < b.pos.Offset
+	})
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("!_TAG_FILE_FORMAT\t2\t/extended format/\n")
+	bw.WriteString("!_TAG_FILE_SORTED\t1\t/0=unsorted, 1=sorted, 2=foldcase/\n")
+	bw.WriteString("!_TAG_PROGRAM_NAME\tidast\t//\n")
+	bw.WriteString("!_TAG_FIELD_DESCRIPTION\tnodeid\t/ID of the declaring node/\n")
+	for _, t := range tags {
+		fmt.Fprintf(bw, "%s\t%s\t%d;\"\t%s", t.name, t.pos.Filename, t.pos.Line, t.kind)
+		if t.scope != "" {
+			fmt.Fprintf(bw, "\t%s", t.scope)
+		}
+		fmt.Fprintf(bw, "\tnodeid:%s\n", tagEscaper.Replace(t.id.String()))
+	}
+	return bw.Flush()
+}
+
+// tagEscaper escapes field values as Universal Ctags does.
+var tagEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`)
+
+// typeScope returns the scope kind of the members of the type declared by
+// s.
+func typeScope(s *ast.TypeSpec) string {
+	switch s.Type.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	}
+	return "type"
+}
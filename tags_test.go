@@ -0,0 +1,85 @@
+package idast
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestWriteTags(t *testing.T) {
+	src := `package p
+
+import "io"
+
+const C, D = 1, 2
+
+var _, v = 0, 0
+
+type T struct {
+	io.Reader
+	X, Y int
+}
+
+type I interface {
+	io.Closer
+	M()
+}
+
+type A = T
+
+func (t *T) M() {}
+
+func F() {}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	var b bytes.Buffer
+	if err := WriteTags(&b, fset, file); err != nil {
+		t.Fatalf("WriteTags: %v", err)
+	}
+
+	want := `!_TAG_FILE_FORMAT	2	/extended format/
+!_TAG_FILE_SORTED	1	/0=unsorted, 1=sorted, 2=foldcase/
+!_TAG_PROGRAM_NAME	idast	//
+!_TAG_FIELD_DESCRIPTION	nodeid	/ID of the declaring node/
+A	p.go	19;"	a	nodeid:Decls/5/GenDecl/Specs/TypeSpec:A
+C	p.go	5;"	c	nodeid:Decls/1/GenDecl/Specs/ValueSpec:C,D
+D	p.go	5;"	c	nodeid:Decls/1/GenDecl/Specs/ValueSpec:C,D
+F	p.go	23;"	f	nodeid:Decls/7/FuncDecl:F
+I	p.go	14;"	i	nodeid:Decls/4/GenDecl/Specs/TypeSpec:I
+M	p.go	16;"	n	interface:I	nodeid:Decls/4/GenDecl/Specs/TypeSpec:I/Type/InterfaceType/Methods/FieldList/List/M/Field
+M	p.go	21;"	f	struct:T	nodeid:Decls/6/FuncDecl:M
+Reader	p.go	10;"	M	struct:T	nodeid:Decls/3/GenDecl/Specs/TypeSpec:T/Type/StructType/Fields/FieldList/List/embed:io.Reader/Field
+T	p.go	9;"	s	nodeid:Decls/3/GenDecl/Specs/TypeSpec:T
+X	p.go	11;"	m	struct:T	nodeid:Decls/3/GenDecl/Specs/TypeSpec:T/Type/StructType/Fields/FieldList/List/X,Y/Field
+Y	p.go	11;"	m	struct:T	nodeid:Decls/3/GenDecl/Specs/TypeSpec:T/Type/StructType/Fields/FieldList/List/X,Y/Field
+v	p.go	7;"	v	nodeid:Decls/2/GenDecl/Specs/ValueSpec:_,v
+`
+	if got := b.String(); got != want {
+		t.Errorf("want tags:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestWriteTagsPositions(t *testing.T) {
+	// The blank embedded field gets no tag and must not move T's, and the
+	// //line directive must not move either.
+	src := "package p\n\n//line gen.y:100\ntype T struct {\n\t_\n}\n"
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("Error parsing src: %v", err)
+	}
+	var b bytes.Buffer
+	if err := WriteTags(&b, fset, file); err != nil {
+		t.Fatalf("WriteTags: %v", err)
+	}
+	want := "T\tp.go\t4;\"\ts\tnodeid:Decls/0/GenDecl/Specs/TypeSpec:T\n"
+	if got := b.String(); !strings.HasSuffix(got, want) {
+		t.Errorf("want tags ending in:\n%s\ngot:\n%s", want, got)
+	}
+}
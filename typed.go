@@ -0,0 +1,337 @@
+package idast
+
+import (
+	"go/ast"
+)
+
+// A TypedVisitor is a Visitor that dispatches each node to the hook for its
+// concrete type. Hooks are optional: nodes whose hook is nil are descended
+// into without a call. If a hook returns false, the children of its node are
+// not visited.
+//
+// A TypedVisitor is a convenience: it performs the same type switch on
+// every node that a hand-written Visitor would, and the walker still visits
+// every node, since nearly any subtree can contain a function literal and
+// thus nodes of any kind.
+type TypedVisitor struct {
+	// Comments and fields
+	Comment      func(*ast.Comment, NodeId) bool
+	CommentGroup func(*ast.CommentGroup, NodeId) bool
+	Field        func(*ast.Field, NodeId) bool
+	FieldList    func(*ast.FieldList, NodeId) bool
+
+	// Expressions
+	BadExpr        func(*ast.BadExpr, NodeId) bool
+	Ident          func(*ast.Ident, NodeId) bool
+	BasicLit       func(*ast.BasicLit, NodeId) bool
+	Ellipsis       func(*ast.Ellipsis, NodeId) bool
+	FuncLit        func(*ast.FuncLit, NodeId) bool
+	CompositeLit   func(*ast.CompositeLit, NodeId) bool
+	ParenExpr      func(*ast.ParenExpr, NodeId) bool
+	SelectorExpr   func(*ast.SelectorExpr, NodeId) bool
+	IndexExpr      func(*ast.IndexExpr, NodeId) bool
+	IndexListExpr  func(*ast.IndexListExpr, NodeId) bool
+	SliceExpr      func(*ast.SliceExpr, NodeId) bool
+	TypeAssertExpr func(*ast.TypeAssertExpr, NodeId) bool
+	CallExpr       func(*ast.CallExpr, NodeId) bool
+	StarExpr       func(*ast.StarExpr, NodeId) bool
+	UnaryExpr      func(*ast.UnaryExpr, NodeId) bool
+	BinaryExpr     func(*ast.BinaryExpr, NodeId) bool
+	KeyValueExpr   func(*ast.KeyValueExpr, NodeId) bool
+
+	// Types
+	ArrayType     func(*ast.ArrayType, NodeId) bool
+	StructType    func(*ast.StructType, NodeId) bool
+	FuncType      func(*ast.FuncType, NodeId) bool
+	InterfaceType func(*ast.InterfaceType, NodeId) bool
+	MapType       func(*ast.MapType, NodeId) bool
+	ChanType      func(*ast.ChanType, NodeId) bool
+
+	// Statements
+	BadStmt        func(*ast.BadStmt, NodeId) bool
+	DeclStmt       func(*ast.DeclStmt, NodeId) bool
+	EmptyStmt      func(*ast.EmptyStmt, NodeId) bool
+	LabeledStmt    func(*ast.LabeledStmt, NodeId) bool
+	ExprStmt       func(*ast.ExprStmt, NodeId) bool
+	SendStmt       func(*ast.SendStmt, NodeId) bool
+	IncDecStmt     func(*ast.IncDecStmt, NodeId) bool
+	AssignStmt     func(*ast.AssignStmt, NodeId) bool
+	GoStmt         func(*ast.GoStmt, NodeId) bool
+	DeferStmt      func(*ast.DeferStmt, NodeId) bool
+	ReturnStmt     func(*ast.ReturnStmt, NodeId) bool
+	BranchStmt     func(*ast.BranchStmt, NodeId) bool
+	BlockStmt      func(*ast.BlockStmt, NodeId) bool
+	IfStmt         func(*ast.IfStmt, NodeId) bool
+	CaseClause     func(*ast.CaseClause, NodeId) bool
+	SwitchStmt     func(*ast.SwitchStmt, NodeId) bool
+	TypeSwitchStmt func(*ast.TypeSwitchStmt, NodeId) bool
+	CommClause     func(*ast.CommClause, NodeId) bool
+	SelectStmt     func(*ast.SelectStmt, NodeId) bool
+	ForStmt        func(*ast.ForStmt, NodeId) bool
+	RangeStmt      func(*ast.RangeStmt, NodeId) bool
+
+	// Declarations
+	ImportSpec func(*ast.ImportSpec, NodeId) bool
+	ValueSpec  func(*ast.ValueSpec, NodeId) bool
+	TypeSpec   func(*ast.TypeSpec, NodeId) bool
+	BadDecl    func(*ast.BadDecl, NodeId) bool
+	GenDecl    func(*ast.GenDecl, NodeId) bool
+	FuncDecl   func(*ast.FuncDecl, NodeId) bool
+
+	// Files and packages
+	File    func(*ast.File, NodeId) bool
+	Package func(*ast.Package, NodeId) bool
+}
+
+func (tv *TypedVisitor) Visit(node ast.Node, id NodeId) Visitor {
+	if tv.dispatch(node, id) {
+		return tv
+	}
+	return nil
+}
+
+// dispatch calls the hook for node's type, if any, and reports whether the
+// walk should descend into node.
+func (tv *TypedVisitor) dispatch(node ast.Node, id NodeId) bool {
+	switch n := node.(type) {
+	case nil:
+		return true
+
+	// Comments and fields
+	case *ast.Comment:
+		if tv.Comment != nil {
+			return tv.Comment(n, id)
+		}
+	case *ast.CommentGroup:
+		if tv.CommentGroup != nil {
+			return tv.CommentGroup(n, id)
+		}
+	case *ast.Field:
+		if tv.Field != nil {
+			return tv.Field(n, id)
+		}
+	case *ast.FieldList:
+		if tv.FieldList != nil {
+			return tv.FieldList(n, id)
+		}
+
+	// Expressions
+	case *ast.BadExpr:
+		if tv.BadExpr != nil {
+			return tv.BadExpr(n, id)
+		}
+	case *ast.Ident:
+		if tv.Ident != nil {
+			return tv.Ident(n, id)
+		}
+	case *ast.BasicLit:
+		if tv.BasicLit != nil {
+			return tv.BasicLit(n, id)
+		}
+	case *ast.Ellipsis:
+		if tv.Ellipsis != nil {
+			return tv.Ellipsis(n, id)
+		}
+	case *ast.FuncLit:
+		if tv.FuncLit != nil {
+			return tv.FuncLit(n, id)
+		}
+	case *ast.CompositeLit:
+		if tv.CompositeLit != nil {
+			return tv.CompositeLit(n, id)
+		}
+	case *ast.ParenExpr:
+		if tv.ParenExpr != nil {
+			return tv.ParenExpr(n, id)
+		}
+	case *ast.SelectorExpr:
+		if tv.SelectorExpr != nil {
+			return tv.SelectorExpr(n, id)
+		}
+	case *ast.IndexExpr:
+		if tv.IndexExpr != nil {
+			return tv.IndexExpr(n, id)
+		}
+	case *ast.IndexListExpr:
+		if tv.IndexListExpr != nil {
+			return tv.IndexListExpr(n, id)
+		}
+	case *ast.SliceExpr:
+		if tv.SliceExpr != nil {
+			return tv.SliceExpr(n, id)
+		}
+	case *ast.TypeAssertExpr:
+		if tv.TypeAssertExpr != nil {
+			return tv.TypeAssertExpr(n, id)
+		}
+	case *ast.CallExpr:
+		if tv.CallExpr != nil {
+			return tv.CallExpr(n, id)
+		}
+	case *ast.StarExpr:
+		if tv.StarExpr != nil {
+			return tv.StarExpr(n, id)
+		}
+	case *ast.UnaryExpr:
+		if tv.UnaryExpr != nil {
+			return tv.UnaryExpr(n, id)
+		}
+	case *ast.BinaryExpr:
+		if tv.BinaryExpr != nil {
+			return tv.BinaryExpr(n, id)
+		}
+	case *ast.KeyValueExpr:
+		if tv.KeyValueExpr != nil {
+			return tv.KeyValueExpr(n, id)
+		}
+
+	// Types
+	case *ast.ArrayType:
+		if tv.ArrayType != nil {
+			return tv.ArrayType(n, id)
+		}
+	case *ast.StructType:
+		if tv.StructType != nil {
+			return tv.StructType(n, id)
+		}
+	case *ast.FuncType:
+		if tv.FuncType != nil {
+			return tv.FuncType(n, id)
+		}
+	case *ast.InterfaceType:
+		if tv.InterfaceType != nil {
+			return tv.InterfaceType(n, id)
+		}
+	case *ast.MapType:
+		if tv.MapType != nil {
+			return tv.MapType(n, id)
+		}
+	case *ast.ChanType:
+		if tv.ChanType != nil {
+			return tv.ChanType(n, id)
+		}
+
+	// Statements
+	case *ast.BadStmt:
+		if tv.BadStmt != nil {
+			return tv.BadStmt(n, id)
+		}
+	case *ast.DeclStmt:
+		if tv.DeclStmt != nil {
+			return tv.DeclStmt(n, id)
+		}
+	case *ast.EmptyStmt:
+		if tv.EmptyStmt != nil {
+			return tv.EmptyStmt(n, id)
+		}
+	case *ast.LabeledStmt:
+		if tv.LabeledStmt != nil {
+			return tv.LabeledStmt(n, id)
+		}
+	case *ast.ExprStmt:
+		if tv.ExprStmt != nil {
+			return tv.ExprStmt(n, id)
+		}
+	case *ast.SendStmt:
+		if tv.SendStmt != nil {
+			return tv.SendStmt(n, id)
+		}
+	case *ast.IncDecStmt:
+		if tv.IncDecStmt != nil {
+			return tv.IncDecStmt(n, id)
+		}
+	case *ast.AssignStmt:
+		if tv.AssignStmt != nil {
+			return tv.AssignStmt(n, id)
+		}
+	case *ast.GoStmt:
+		if tv.GoStmt != nil {
+			return tv.GoStmt(n, id)
+		}
+	case *ast.DeferStmt:
+		if tv.DeferStmt != nil {
+			return tv.DeferStmt(n, id)
+		}
+	case *ast.ReturnStmt:
+		if tv.ReturnStmt != nil {
+			return tv.ReturnStmt(n, id)
+		}
+	case *ast.BranchStmt:
+		if tv.BranchStmt != nil {
+			return tv.BranchStmt(n, id)
+		}
+	case *ast.BlockStmt:
+		if tv.BlockStmt != nil {
+			return tv.BlockStmt(n, id)
+		}
+	case *ast.IfStmt:
+		if tv.IfStmt != nil {
+			return tv.IfStmt(n, id)
+		}
+	case *ast.CaseClause:
+		if tv.CaseClause != nil {
+			return tv.CaseClause(n, id)
+		}
+	case *ast.SwitchStmt:
+		if tv.SwitchStmt != nil {
+			return tv.SwitchStmt(n, id)
+		}
+	case *ast.TypeSwitchStmt:
+		if tv.TypeSwitchStmt != nil {
+			return tv.TypeSwitchStmt(n, id)
+		}
+	case *ast.CommClause:
+		if tv.CommClause != nil {
+			return tv.CommClause(n, id)
+		}
+	case *ast.SelectStmt:
+		if tv.SelectStmt != nil {
+			return tv.SelectStmt(n, id)
+		}
+	case *ast.ForStmt:
+		if tv.ForStmt != nil {
+			return tv.ForStmt(n, id)
+		}
+	case *ast.RangeStmt:
+		if tv.RangeStmt != nil {
+			return tv.RangeStmt(n, id)
+		}
+
+	// Declarations
+	case *ast.ImportSpec:
+		if tv.ImportSpec != nil {
+			return tv.ImportSpec(n, id)
+		}
+	case *ast.ValueSpec:
+		if tv.ValueSpec != nil {
+			return tv.ValueSpec(n, id)
+		}
+	case *ast.TypeSpec:
+		if tv.TypeSpec != nil {
+			return tv.TypeSpec(n, id)
+		}
+	case *ast.BadDecl:
+		if tv.BadDecl != nil {
+			return tv.BadDecl(n, id)
+		}
+	case *ast.GenDecl:
+		if tv.GenDecl != nil {
+			return tv.GenDecl(n, id)
+		}
+	case *ast.FuncDecl:
+		if tv.FuncDecl != nil {
+			return tv.FuncDecl(n, id)
+		}
+
+	// Files and packages
+	case *ast.File:
+		if tv.File != nil {
+			return tv.File(n, id)
+		}
+	case *ast.Package:
+		if tv.Package != nil {
+			return tv.Package(n, id)
+		}
+	}
+	return true
+}
@@ -3,9 +3,9 @@ package idast
 import (
 	"fmt"
 	"go/ast"
-	"path"
 	"reflect"
 	"strconv"
+	"strings"
 )
 
 // A Visitor's Visit method is invoked for each node encountered by
@@ -19,54 +19,267 @@ type Visitor interface {
 
 // Helper functions for common node lists. They may be empty.
 
-func walkIdentList(v Visitor, list []*ast.Ident, id NodeId) {
+func (cfg *Config) walkIdentList(v Visitor, list []*ast.Ident, id NodeId) {
 	for i, x := range list {
 		name := x.Name
 		if name == "_" {
 			name += ":" + strconv.Itoa(i)
 		}
 		id.push(name)
-		walk(v, x, id)
+		cfg.walk(v, x, id)
 		id.pop()
 	}
 }
 
-func walkExprList(v Visitor, list []ast.Expr, id NodeId) {
+func (cfg *Config) walkExprList(v Visitor, list []ast.Expr, id NodeId) {
 	for i, x := range list {
 		id.push(strconv.Itoa(i))
-		walk(v, x, id)
+		cfg.walk(v, x, id)
 		id.pop()
 	}
 }
 
-func walkStmtList(v Visitor, list []ast.Stmt, id NodeId) {
+func (cfg *Config) walkStmtList(v Visitor, list []ast.Stmt, id NodeId) {
+	var seen map[string]int
+	if cfg.Mode&StmtHashes != 0 {
+		seen = make(map[string]int, len(list))
+	}
 	for i, x := range list {
-		id.push(strconv.Itoa(i))
-		walk(v, x, id)
+		if seen != nil {
+			c := stmtHash(x)
+			if n := seen[c]; n > 0 {
+				id.push(c + ":" + strconv.Itoa(n))
+			} else {
+				id.push(c)
+			}
+			seen[c]++
+		} else {
+			id.push(strconv.Itoa(i))
+		}
+		cfg.walk(v, x, id)
 		id.pop()
 	}
 }
 
-func walkDeclList(v Visitor, list []ast.Decl, id NodeId) {
+// walkSpecList identifies each spec by its specComponents.
+func (cfg *Config) walkSpecList(v Visitor, list []ast.Spec, id NodeId) {
+	for i, c := range specComponents(list) {
+		cfg.walkAs(v, list[i], id, c)
+	}
+}
+
+// specComponents returns the ID components of the specs in list: their
+// idComponent, which names what they declare or import, rather than their
+// index, so that specs keep their IDs when they are reordered. A component
+// that is taken by an earlier spec, as for blank names or a path imported
+// twice, gets an ordinal appended.
+func specComponents(list []ast.Spec) []string {
+	cs := make([]string, len(list))
+	for i, x := range list {
+		cs[i] = idComponent(x)
+	}
+	return withOrdinals(cs)
+}
+
+// childComponent returns the ID component that the walker gives child as a
+// child of parent: its idComponent or, for a spec, its specComponents entry.
+func childComponent(parent, child ast.Node) string {
+	if d, ok := parent.(*ast.GenDecl); ok {
+		for i, s := range d.Specs {
+			if s == child {
+				return specComponents(d.Specs)[i]
+			}
+		}
+	}
+	return idComponent(child)
+}
+
+// withOrdinals appends ":1", ":2", ... to each key in keys that is taken by
+// an earlier one, as walkStmtList does for statement hashes, and returns
+// keys.
+func withOrdinals(keys []string) []string {
+	seen := make(map[string]int, len(keys))
+	for i, k := range keys {
+		if n := seen[k]; n > 0 {
+			keys[i] = k + ":" + strconv.Itoa(n)
+		}
+		seen[k]++
+	}
+	return keys
+}
+
+func (cfg *Config) walkDeclList(v Visitor, list []ast.Decl, id NodeId) {
 	for i, x := range list {
 		id.push(strconv.Itoa(i))
-		walk(v, x, id)
+		cfg.walk(v, x, id)
 		id.pop()
 	}
 }
 
+// namedFields reports whether the FieldList whose ID is id holds the fields
+// of a struct or the methods of an interface, which are identified by name
+// rather than by index, so that they keep their IDs when they are
+// reordered. The ID tells, so a walk that starts at the list with the base
+// that BaseId returns for it keys the fields the same way as a walk of the
+// whole tree.
+func namedFields(id NodeId) bool {
+	n := len(id)
+	return n >= 3 && (id[n-3] == "StructType" && id[n-2] == "Fields" || id[n-3] == "InterfaceType" && id[n-2] == "Methods")
+}
+
+// fieldKeys returns the ID components of the fields in list: their index,
+// or if named is set, their fieldKey. A key that is taken by an earlier
+// field, as when an interface embeds two types of the same name from
+// different packages, gets an ordinal appended.
+func fieldKeys(list *ast.FieldList, named bool) []string {
+	keys := make([]string, len(list.List))
+	for i, f := range list.List {
+		if named {
+			keys[i] = fieldKey(f, i)
+		} else {
+			keys[i] = strconv.Itoa(i)
+		}
+	}
+	return withOrdinals(keys)
+}
+
+// fieldKey returns the ID component for the i'th field of a struct or
+// interface: its comma-separated names, or "embed:" and the (possibly
+// qualified) type name of an embedded field, such as "embed:io.Reader", so
+// that it can't be mistaken for a method of the same name. Fields without a
+// usable name, such as the union terms of a constraint, fall back to their
+// index, and blank names get the index appended, as in walkIdentList.
+func fieldKey(f *ast.Field, i int) string {
+	if len(f.Names) == 0 {
+		if key := embeddedKey(f.Type); key != "" {
+			return "embed:" + key
+		}
+		return strconv.Itoa(i)
+	}
+	names := make([]string, len(f.Names))
+	blank := false
+	for j, name := range f.Names {
+		names[j] = name.Name
+		blank = blank || name.Name == "_"
+	}
+	key := strings.Join(names, ",")
+	if blank {
+		key += ":" + strconv.Itoa(i)
+	}
+	return key
+}
+
+// funcKey returns the ID component of d, with the base type name of its
+// receiver, if any, qualifying the name, as in "FuncDecl:T.M", so that
+// methods of the same name on different types can be told apart.
+func funcKey(d *ast.FuncDecl) string {
+	if d.Recv != nil && len(d.Recv.List) > 0 {
+		return "FuncDecl:" + embeddedName(d.Recv.List[0].Type) + "." + d.Name.Name
+	}
+	return idComponent(d)
+}
+
+// embeddedName returns the field name implied by an embedded type, or "" if
+// x is not a (possibly qualified or pointer) type name.
+func embeddedName(x ast.Expr) string {
+	switch t := x.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.IndexExpr:
+		return embeddedName(t.X)
+	case *ast.IndexListExpr:
+		return embeddedName(t.X)
+	}
+	return ""
+}
+
+// embeddedKey is like embeddedName, but keeps the package name of a
+// qualified type name.
+func embeddedKey(x ast.Expr) string {
+	switch t := x.(type) {
+	case *ast.StarExpr:
+		return embeddedKey(t.X)
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok {
+			return pkg.Name + "." + t.Sel.Name
+		}
+	case *ast.IndexExpr:
+		return embeddedKey(t.X)
+	case *ast.IndexListExpr:
+		return embeddedKey(t.X)
+	}
+	return embeddedName(x)
+}
+
 // Walk traverses an AST in depth-first order: It starts by calling
 // v.Visit(node, id); node must not be nil. If the visitor w returned
 // by v.Visit(node, id) is not nil, Walk is invoked recursively with
 // visitor w for each of the non-nil children of node, followed by a
 // call of w.Visit(nil, id).
 //
+// Nodes of types that the walker doesn't know are visited, but their
+// children are not; Check reports such nodes.
+//
 func Walk(v Visitor, n ast.Node) {
-	id := make(NodeId, 0, 100)
-	walk(v, n, id)
+	defaultConfig.Walk(v, n)
+}
+
+// WalkFrom is like Walk, but the IDs passed to v are prefixed with base
+// instead of starting out empty. Walking a subtree from the base returned by
+// BaseId yields the same IDs as walking the whole tree that contains it,
+// except where the subtree is a spec that repeats the key of an earlier spec
+// in its declaration, such as a second import _ "embed": its ID component
+// has an ordinal that n alone does not tell. Use WalkAt for such nodes.
+func WalkFrom(v Visitor, n ast.Node, base NodeId) {
+	defaultConfig.WalkFrom(v, n, base)
+}
+
+// WalkAt is like WalkFrom, but id is the ID of n itself, as returned by Map
+// or Find for the tree that contains n, rather than the base that n's
+// component is appended to. Walking a subtree at its ID always yields the
+// same IDs as walking the whole tree.
+func WalkAt(v Visitor, n ast.Node, id NodeId) {
+	defaultConfig.WalkAt(v, n, id)
+}
+
+// Walk is like the package-level Walk, computing IDs as configured by cfg.
+func (cfg *Config) Walk(v Visitor, n ast.Node) {
+	cfg.WalkFrom(v, n, nil)
+}
+
+// WalkFrom is like the package-level WalkFrom, computing IDs as configured
+// by cfg.
+func (cfg *Config) WalkFrom(v Visitor, n ast.Node, base NodeId) {
+	id := make(NodeId, len(base), len(base)+100)
+	copy(id, base)
+	cfg.walk(v, n, id)
+}
+
+// WalkAt is like the package-level WalkAt, computing IDs as configured by
+// cfg.
+func (cfg *Config) WalkAt(v Visitor, n ast.Node, id NodeId) {
+	base, c := id, ""
+	if idComponent(n) != "" && len(id) > 0 {
+		base, c = id[:len(id)-1], id[len(id)-1]
+	}
+	nid := make(NodeId, len(base), len(base)+100)
+	copy(nid, base)
+	cfg.walkAs(v, n, nid, c)
 }
 
 func idComponent(node ast.Node) string {
+	c, _ := component(node)
+	return c
+}
+
+// component returns the ID component of node, and whether node is of a type
+// that the walker knows. Nodes of unknown types are identified by their type
+// name.
+func component(node ast.Node) (string, bool) {
 	switch n := node.(type) {
 	// Comments and fields
 	case *ast.Comment:
@@ -97,6 +310,8 @@ func idComponent(node ast.Node) string {
 
 	case *ast.IndexExpr:
 
+	case *ast.IndexListExpr:
+
 	case *ast.SliceExpr:
 
 	case *ast.TypeAssertExpr:
@@ -169,36 +384,57 @@ func idComponent(node ast.Node) string {
 
 	// Declarations
 	case *ast.ImportSpec:
+		path := n.Path.Value
+		if p, err := strconv.Unquote(path); err == nil {
+			path = strconv.Quote(p)
+		}
+		return "ImportSpec:" + path, true
 
 	case *ast.ValueSpec:
+		names := make([]string, len(n.Names))
+		for i, name := range n.Names {
+			names[i] = name.Name
+		}
+		return "ValueSpec:" + strings.Join(names, ","), true
 
 	case *ast.TypeSpec:
-		return "TypeSpec:" + n.Name.Name
+		return "TypeSpec:" + n.Name.Name, true
 
 	case *ast.BadDecl:
 
 	case *ast.GenDecl:
 
 	case *ast.FuncDecl:
-		return "FuncDecl:" + n.Name.Name
+		return "FuncDecl:" + n.Name.Name, true
 
 	// Files and packages
 	case *ast.File:
 		// The filename is pushed and popped when the *ast.Package is encountered, because only the
 		// package knows the filename (the file only knows its package).
-		return ""
+		return "", true
 
 	case *ast.Package:
 
 	default:
-		fmt.Printf("ast.walk: unexpected node type %T", n)
-		panic("ast.walk")
+		t := reflect.TypeOf(node)
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		return t.Name(), false
+	}
+	return reflect.TypeOf(node).Elem().Name(), true
+}
+
+func (cfg *Config) walk(v Visitor, node ast.Node, id NodeId) {
+	if node == nil {
+		return
 	}
-	return reflect.TypeOf(node).Elem().Name()
+	cfg.walkAs(v, node, id, idComponent(node))
 }
 
-func walk(v Visitor, node ast.Node, id NodeId) {
-	c := idComponent(node)
+// walkAs is like walk, but identifies node by the component c (if not
+// empty) instead of by its idComponent.
+func (cfg *Config) walkAs(v Visitor, node ast.Node, id NodeId, c string) {
 	if c != "" {
 		id.push(c)
 		defer id.pop()
@@ -220,33 +456,34 @@ func walk(v Visitor, node ast.Node, id NodeId) {
 		id.push("List")
 		for i, c := range n.List {
 			id.push(strconv.Itoa(i))
-			walk(v, c, id)
+			cfg.walk(v, c, id)
 			id.pop()
 		}
 		id.pop()
 
 	case *ast.Field:
 		if n.Doc != nil {
-			walk(v, n.Doc, id.pushed("Doc"))
+			cfg.walk(v, n.Doc, id.pushed("Doc"))
 		}
 		id.push("Names")
-		walkIdentList(v, n.Names, id)
+		cfg.walkIdentList(v, n.Names, id)
 		id.pop()
 		id.push("Type")
-		walk(v, n.Type, id)
+		cfg.walk(v, n.Type, id)
 		id.pop()
 		if n.Tag != nil {
-			walk(v, n.Tag, id.pushed("Tag"))
+			cfg.walk(v, n.Tag, id.pushed("Tag"))
 		}
 		if n.Comment != nil {
-			walk(v, n.Comment, id.pushed("Comment"))
+			cfg.walk(v, n.Comment, id.pushed("Comment"))
 		}
 
 	case *ast.FieldList:
+		keys := fieldKeys(n, namedFields(id))
 		id.push("List")
 		for i, f := range n.List {
-			id.push(strconv.Itoa(i))
-			walk(v, f, id)
+			id.push(keys[i])
+			cfg.walk(v, f, id)
 			id.pop()
 		}
 		id.pop()
@@ -263,122 +500,132 @@ func walk(v Visitor, node ast.Node, id NodeId) {
 
 	case *ast.Ellipsis:
 		if n.Elt != nil {
-			walk(v, n.Elt, id.pushed("Elt"))
+			cfg.walk(v, n.Elt, id.pushed("Elt"))
 		}
 
 	case *ast.FuncLit:
-		walk(v, n.Type, id.pushed("Type"))
-		walk(v, n.Body, id.pushed("Body"))
+		cfg.walk(v, n.Type, id.pushed("Type"))
+		cfg.walk(v, n.Body, id.pushed("Body"))
 
 	case *ast.CompositeLit:
 		if n.Type != nil {
-			walk(v, n.Type, id.pushed("Type"))
+			cfg.walk(v, n.Type, id.pushed("Type"))
 		}
-		walkExprList(v, n.Elts, id.pushed("Elts"))
+		cfg.walkExprList(v, n.Elts, id.pushed("Elts"))
 
 	case *ast.ParenExpr:
 		id.push("X")
-		walk(v, n.X, id)
+		cfg.walk(v, n.X, id)
 		id.pop()
 
 	case *ast.SelectorExpr:
 		id.push("X")
-		walk(v, n.X, id)
+		cfg.walk(v, n.X, id)
 		id.pop()
 		id.push("Sel")
-		walk(v, n.Sel, id)
+		cfg.walk(v, n.Sel, id)
 		id.pop()
 
 	case *ast.IndexExpr:
 		id.push("X")
-		walk(v, n.X, id)
+		cfg.walk(v, n.X, id)
 		id.pop()
 		id.push("Index")
-		walk(v, n.Index, id)
+		cfg.walk(v, n.Index, id)
 		id.pop()
 
+	case *ast.IndexListExpr:
+		cfg.walk(v, n.X, id.pushed("X"))
+		cfg.walkExprList(v, n.Indices, id.pushed("Indices"))
+
 	case *ast.SliceExpr:
 		id.push("X")
-		walk(v, n.X, id)
+		cfg.walk(v, n.X, id)
 		id.pop()
 		if n.Low != nil {
 			id.push("Low")
-			walk(v, n.Low, id)
+			cfg.walk(v, n.Low, id)
 			id.pop()
 		}
 		if n.High != nil {
 			id.push("High")
-			walk(v, n.High, id)
+			cfg.walk(v, n.High, id)
 			id.pop()
 		}
+		if n.Max != nil {
+			cfg.walk(v, n.Max, id.pushed("Max"))
+		}
 
 	case *ast.TypeAssertExpr:
-		walk(v, n.X, id.pushed("X"))
+		cfg.walk(v, n.X, id.pushed("X"))
 		if n.Type != nil {
-			walk(v, n.Type, id.pushed("Type"))
+			cfg.walk(v, n.Type, id.pushed("Type"))
 		}
 
 	case *ast.CallExpr:
 		id.push("Fun")
-		walk(v, n.Fun, id)
+		cfg.walk(v, n.Fun, id)
 		id.pop()
 		id.push("Args")
-		walkExprList(v, n.Args, id)
+		cfg.walkExprList(v, n.Args, id)
 		id.pop()
 
 	case *ast.StarExpr:
 		id.push("X")
-		walk(v, n.X, id)
+		cfg.walk(v, n.X, id)
 		id.pop()
 
 	case *ast.UnaryExpr:
 		id.push("X")
-		walk(v, n.X, id)
+		cfg.walk(v, n.X, id)
 		id.pop()
 
 	case *ast.BinaryExpr:
 		id.push("X")
-		walk(v, n.X, id)
+		cfg.walk(v, n.X, id)
 		id.pop()
 		id.push("Y")
-		walk(v, n.Y, id)
+		cfg.walk(v, n.Y, id)
 		id.pop()
 
 	case *ast.KeyValueExpr:
 		id.push("Key")
-		walk(v, n.Key, id)
+		cfg.walk(v, n.Key, id)
 		id.pop()
 		id.push("Value")
-		walk(v, n.Value, id)
+		cfg.walk(v, n.Value, id)
 		id.pop()
 
 	// Types
 	case *ast.ArrayType:
 		if n.Len != nil {
-			walk(v, n.Len, id.pushed("Len"))
+			cfg.walk(v, n.Len, id.pushed("Len"))
 		}
-		walk(v, n.Elt, id.pushed("Elt"))
+		cfg.walk(v, n.Elt, id.pushed("Elt"))
 
 	case *ast.StructType:
-		walk(v, n.Fields, id.pushed("Fields"))
+		cfg.walk(v, n.Fields, id.pushed("Fields"))
 
 	case *ast.FuncType:
+		if n.TypeParams != nil {
+			cfg.walk(v, n.TypeParams, id.pushed("TypeParams"))
+		}
 		if n.Params != nil {
-			walk(v, n.Params, id.pushed("Params"))
+			cfg.walk(v, n.Params, id.pushed("Params"))
 		}
 		if n.Results != nil {
-			walk(v, n.Results, id.pushed("Results"))
+			cfg.walk(v, n.Results, id.pushed("Results"))
 		}
 
 	case *ast.InterfaceType:
-		walk(v, n.Methods, id.pushed("Methods"))
+		cfg.walk(v, n.Methods, id.pushed("Methods"))
 
 	case *ast.MapType:
-		walk(v, n.Key, id.pushed("Key"))
-		walk(v, n.Value, id.pushed("Value"))
+		cfg.walk(v, n.Key, id.pushed("Key"))
+		cfg.walk(v, n.Value, id.pushed("Value"))
 
 	case *ast.ChanType:
-		walk(v, n.Value, id.pushed("Value"))
+		cfg.walk(v, n.Value, id.pushed("Value"))
 
 	// Statements
 	case *ast.BadStmt:
@@ -386,164 +633,169 @@ func walk(v Visitor, node ast.Node, id NodeId) {
 
 	case *ast.DeclStmt:
 		id.push("Decl")
-		walk(v, n.Decl, id)
+		cfg.walk(v, n.Decl, id)
 		id.pop()
 
 	case *ast.EmptyStmt:
 		// nothing to do
 
 	case *ast.LabeledStmt:
-		walk(v, n.Label, id.pushed("Label"))
-		walk(v, n.Stmt, id.pushed("Stmt"))
+		cfg.walk(v, n.Label, id.pushed("Label"))
+		cfg.walk(v, n.Stmt, id.pushed("Stmt"))
 
 	case *ast.ExprStmt:
 		id.push("X")
-		walk(v, n.X, id)
+		cfg.walk(v, n.X, id)
 		id.pop()
 
 	case *ast.SendStmt:
-		walk(v, n.Chan, id.pushed("Chan"))
-		walk(v, n.Value, id.pushed("Value"))
+		cfg.walk(v, n.Chan, id.pushed("Chan"))
+		cfg.walk(v, n.Value, id.pushed("Value"))
 
 	case *ast.IncDecStmt:
-		walk(v, n.X, id.pushed("X"))
+		cfg.walk(v, n.X, id.pushed("X"))
 
 	case *ast.AssignStmt:
 		id.push("Lhs")
-		walkExprList(v, n.Lhs, id)
+		cfg.walkExprList(v, n.Lhs, id)
 		id.pop()
 		id.push("Rhs")
-		walkExprList(v, n.Rhs, id)
+		cfg.walkExprList(v, n.Rhs, id)
 		id.pop()
 
 	case *ast.GoStmt:
-		walk(v, n.Call, id.pushed("Call"))
+		cfg.walk(v, n.Call, id.pushed("Call"))
 
 	case *ast.DeferStmt:
-		walk(v, n.Call, id.pushed("Call"))
+		cfg.walk(v, n.Call, id.pushed("Call"))
 
 	case *ast.ReturnStmt:
 		id.push("Results")
-		walkExprList(v, n.Results, id)
+		cfg.walkExprList(v, n.Results, id)
 		id.pop()
 
 	case *ast.BranchStmt:
 		if n.Label != nil {
-			walk(v, n.Label, id.pushed("Label"))
+			cfg.walk(v, n.Label, id.pushed("Label"))
 		}
 
 	case *ast.BlockStmt:
 		id.push("List")
-		walkStmtList(v, n.List, id)
+		cfg.walkStmtList(v, n.List, id)
 		id.pop()
 
 	case *ast.IfStmt:
 		if n.Init != nil {
 			id.push("Init")
-			walk(v, n.Init, id)
+			cfg.walk(v, n.Init, id)
 			id.pop()
 		}
 		id.push("Cond")
-		walk(v, n.Cond, id)
+		cfg.walk(v, n.Cond, id)
 		id.pop()
 		id.push("Body")
-		walk(v, n.Body, id)
+		cfg.walk(v, n.Body, id)
 		id.pop()
 		if n.Else != nil {
-			walk(v, n.Else, id.pushed("Else"))
+			cfg.walk(v, n.Else, id.pushed("Else"))
 		}
 
 	case *ast.CaseClause:
-		walkExprList(v, n.List, id.pushed("List"))
-		walkStmtList(v, n.Body, id.pushed("Body"))
+		cfg.walkExprList(v, n.List, id.pushed("List"))
+		cfg.walkStmtList(v, n.Body, id.pushed("Body"))
 
 	case *ast.SwitchStmt:
 		if n.Init != nil {
-			walk(v, n.Init, id.pushed("Init"))
+			cfg.walk(v, n.Init, id.pushed("Init"))
 		}
 		if n.Tag != nil {
-			walk(v, n.Tag, id.pushed("Tag"))
+			cfg.walk(v, n.Tag, id.pushed("Tag"))
 		}
-		walk(v, n.Body, id.pushed("Body"))
+		cfg.walk(v, n.Body, id.pushed("Body"))
 
 	case *ast.TypeSwitchStmt:
 		if n.Init != nil {
-			walk(v, n.Init, id.pushed("Init"))
+			cfg.walk(v, n.Init, id.pushed("Init"))
 		}
-		walk(v, n.Assign, id.pushed("Assign"))
-		walk(v, n.Body, id.pushed("Body"))
+		cfg.walk(v, n.Assign, id.pushed("Assign"))
+		cfg.walk(v, n.Body, id.pushed("Body"))
 
 	case *ast.CommClause:
 		if n.Comm != nil {
-			walk(v, n.Comm, id.pushed("Comm"))
+			cfg.walk(v, n.Comm, id.pushed("Comm"))
 		}
-		walkStmtList(v, n.Body, id.pushed("Body"))
+		cfg.walkStmtList(v, n.Body, id.pushed("Body"))
 
 	case *ast.SelectStmt:
-		walk(v, n.Body, id.pushed("Body"))
+		cfg.walk(v, n.Body, id.pushed("Body"))
 
 	case *ast.ForStmt:
 		if n.Init != nil {
-			walk(v, n.Init, id.pushed("Init"))
+			cfg.walk(v, n.Init, id.pushed("Init"))
 		}
 		if n.Cond != nil {
-			walk(v, n.Cond, id.pushed("Cond"))
+			cfg.walk(v, n.Cond, id.pushed("Cond"))
 		}
 		if n.Post != nil {
-			walk(v, n.Post, id.pushed("Post"))
+			cfg.walk(v, n.Post, id.pushed("Post"))
 		}
-		walk(v, n.Body, id.pushed("Body"))
+		cfg.walk(v, n.Body, id.pushed("Body"))
 
 	case *ast.RangeStmt:
-		walk(v, n.Key, id.pushed("Key"))
+		if n.Key != nil {
+			cfg.walk(v, n.Key, id.pushed("Key"))
+		}
 		if n.Value != nil {
-			walk(v, n.Value, id.pushed("Value"))
+			cfg.walk(v, n.Value, id.pushed("Value"))
 		}
-		walk(v, n.X, id.pushed("X"))
-		walk(v, n.Body, id.pushed("Body"))
+		cfg.walk(v, n.X, id.pushed("X"))
+		cfg.walk(v, n.Body, id.pushed("Body"))
 
 	// Declarations
 	case *ast.ImportSpec:
 		if n.Doc != nil {
-			walk(v, n.Doc, id.pushed("Doc"))
+			cfg.walk(v, n.Doc, id.pushed("Doc"))
 		}
 		if n.Name != nil {
-			walk(v, n.Name, id.pushed("Name"))
+			cfg.walk(v, n.Name, id.pushed("Name"))
 		}
-		walk(v, n.Path, id.pushed("Path"))
+		cfg.walk(v, n.Path, id.pushed("Path"))
 		if n.Comment != nil {
-			walk(v, n.Comment, id.pushed("Comment"))
+			cfg.walk(v, n.Comment, id.pushed("Comment"))
 		}
 
 	case *ast.ValueSpec:
 		if n.Doc != nil {
 			id.push("Doc")
-			walk(v, n.Doc, id)
+			cfg.walk(v, n.Doc, id)
 			id.pop()
 		}
 		id.push("Names")
-		walkIdentList(v, n.Names, id)
+		cfg.walkIdentList(v, n.Names, id)
 		id.pop()
 		if n.Type != nil {
 			id.push("Type")
-			walk(v, n.Type, id)
+			cfg.walk(v, n.Type, id)
 			id.pop()
 		}
 		id.push("Values")
-		walkExprList(v, n.Values, id)
+		cfg.walkExprList(v, n.Values, id)
 		id.pop()
 		if n.Comment != nil {
-			walk(v, n.Comment, id.pushed("Comment"))
+			cfg.walk(v, n.Comment, id.pushed("Comment"))
 		}
 
 	case *ast.TypeSpec:
 		if n.Doc != nil {
-			walk(v, n.Doc, id.pushed("Doc"))
+			cfg.walk(v, n.Doc, id.pushed("Doc"))
+		}
+		cfg.walk(v, n.Name, id.pushed("Name"))
+		if n.TypeParams != nil {
+			cfg.walk(v, n.TypeParams, id.pushed("TypeParams"))
 		}
-		walk(v, n.Name, id.pushed("Name"))
-		walk(v, n.Type, id.pushed("Type"))
+		cfg.walk(v, n.Type, id.pushed("Type"))
 		if n.Comment != nil {
-			walk(v, n.Comment, id.pushed("Comment"))
+			cfg.walk(v, n.Comment, id.pushed("Comment"))
 		}
 
 	case *ast.BadDecl:
@@ -552,37 +804,31 @@ func walk(v Visitor, node ast.Node, id NodeId) {
 	case *ast.GenDecl:
 		if n.Doc != nil {
 			id.push("Doc")
-			walk(v, n.Doc, id)
+			cfg.walk(v, n.Doc, id)
 			id.pop()
 		}
-		id.push("Specs")
-		for i, s := range n.Specs {
-			id.push(strconv.Itoa(i))
-			walk(v, s, id)
-			id.pop()
-		}
-		id.pop()
+		cfg.walkSpecList(v, n.Specs, id.pushed("Specs"))
 
 	case *ast.FuncDecl:
 		if n.Doc != nil {
-			walk(v, n.Doc, id.pushed("Doc"))
+			cfg.walk(v, n.Doc, id.pushed("Doc"))
 		}
 		if n.Recv != nil {
-			walk(v, n.Recv, id.pushed("Recv"))
+			cfg.walk(v, n.Recv, id.pushed("Recv"))
 		}
-		walk(v, n.Name, id.pushed("Name"))
-		walk(v, n.Type, id.pushed("Type"))
+		cfg.walk(v, n.Name, id.pushed("Name"))
+		cfg.walk(v, n.Type, id.pushed("Type"))
 		if n.Body != nil {
-			walk(v, n.Body, id.pushed("Body"))
+			cfg.walk(v, n.Body, id.pushed("Body"))
 		}
 
 	// Files and packages
 	case *ast.File:
 		if n.Doc != nil {
-			walk(v, n.Doc, id.pushed("Doc"))
+			cfg.walk(v, n.Doc, id.pushed("Doc"))
 		}
-		walk(v, n.Name, id.pushed("Name"))
-		walkDeclList(v, n.Decls, id.pushed("Decls"))
+		cfg.walk(v, n.Name, id.pushed("Name"))
+		cfg.walkDeclList(v, n.Decls, id.pushed("Decls"))
 		// don't walk n.Comments - they have been
 		// visited already through the individual
 		// nodes
@@ -590,20 +836,51 @@ func walk(v Visitor, node ast.Node, id NodeId) {
 	case *ast.Package:
 		id.push("Files")
 		for filename, f := range n.Files {
-			id.push(path.Base(filename))
-			walk(v, f, id)
+			id.push(cfg.fileComponent(filename, f))
+			cfg.walk(v, f, id)
 			id.pop()
 		}
 		id.pop()
 
 	default:
-		fmt.Printf("ast.walk: unexpected node type %T", n)
-		panic("ast.walk")
+		// A node of a type the walker doesn't know; see Check.
 	}
 
 	v.Visit(nil, id)
 }
 
+// An UnsupportedNodeError reports a node of a type that the walker doesn't
+// know, such as one added to go/ast after this package was written.
+type UnsupportedNodeError struct {
+	Node ast.Node
+	Id   NodeId
+}
+
+func (e *UnsupportedNodeError) Error() string {
+	return fmt.Sprintf("idast: unsupported node type %T at %s", e.Node, e.Id.String())
+}
+
+// Check returns an *UnsupportedNodeError for the first node in root, in walk
+// order, whose type the walker doesn't know, or nil if there is none.
+func Check(root ast.Node) error {
+	return defaultConfig.Check(root)
+}
+
+// Check is like the package-level Check, computing IDs as configured by cfg.
+func (cfg *Config) Check(root ast.Node) error {
+	var err error
+	cfg.Inspect(root, func(n ast.Node, id NodeId) bool {
+		if err != nil || n == nil {
+			return false
+		}
+		if _, ok := component(n); !ok {
+			err = &UnsupportedNodeError{n, id.dup()}
+		}
+		return true
+	})
+	return err
+}
+
 type inspector func(ast.Node, NodeId) bool
 
 func (f inspector) Visit(node ast.Node, id NodeId) Visitor {
@@ -618,5 +895,11 @@ func (f inspector) Visit(node ast.Node, id NodeId) Visitor {
 // for all the non-nil children of node, recursively.
 //
 func Inspect(node ast.Node, f func(ast.Node, NodeId) bool) {
-	Walk(inspector(f), node)
+	defaultConfig.Inspect(node, f)
+}
+
+// Inspect is like the package-level Inspect, computing IDs as configured by
+// cfg.
+func (cfg *Config) Inspect(node ast.Node, f func(ast.Node, NodeId) bool) {
+	cfg.Walk(inspector(f), node)
 }
@@ -0,0 +1,95 @@
+package idast
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// An XRef links identifier uses to their declarations, by ID.
+type XRef struct {
+	defs map[string]NodeId
+	refs map[string][]NodeId
+}
+
+// NewXRef links every identifier in root that refers to a declaration in
+// root to the ID of the declaring identifier. If info is not nil, it must
+// record the Defs and Uses of root, as type-checked by go/types. Otherwise
+// the parser's syntactic object resolution (ast.Object) is used, which only
+// links identifiers within a single file.
+func NewXRef(root ast.Node, info *types.Info) *XRef {
+	return defaultConfig.NewXRef(root, info)
+}
+
+// NewXRef is like the package-level NewXRef, computing IDs as configured by
+// cfg.
+func (cfg *Config) NewXRef(root ast.Node, info *types.Info) *XRef {
+	type identWithId struct {
+		ident *ast.Ident
+		id    NodeId
+	}
+	var idents []identWithId
+	cfg.Inspect(root, func(n ast.Node, id NodeId) bool {
+		if ident, ok := n.(*ast.Ident); ok {
+			idents = append(idents, identWithId{ident, id.dup()})
+		}
+		return true
+	})
+
+	x := &XRef{defs: make(map[string]NodeId), refs: make(map[string][]NodeId)}
+	if info != nil {
+		defs := make(map[types.Object]NodeId)
+		for _, i := range idents {
+			if obj := info.Defs[i.ident]; obj != nil {
+				defs[obj] = i.id
+				x.defs[i.id.String()] = i.id
+			}
+		}
+		for _, i := range idents {
+			if def, ok := defs[info.Uses[i.ident]]; ok {
+				x.link(i.id, def)
+			}
+		}
+	} else {
+		defs := make(map[*ast.Object]NodeId)
+		for _, i := range idents {
+			if obj := i.ident.Obj; obj != nil && obj.Pos() == i.ident.Pos() {
+				defs[obj] = i.id
+				x.defs[i.id.String()] = i.id
+			}
+		}
+		for _, i := range idents {
+			if obj := i.ident.Obj; obj != nil && obj.Pos() != i.ident.Pos() {
+				if def, ok := defs[obj]; ok {
+					x.link(i.id, def)
+				}
+			}
+		}
+	}
+	return x
+}
+
+func (x *XRef) link(use, def NodeId) {
+	x.defs[use.String()] = def
+	s := def.String()
+	x.refs[s] = append(x.refs[s], use)
+}
+
+// Refs returns the IDs of the uses of each referenced declaration, in walk
+// order, keyed by the ID (as returned by NodeId.String) of the declaring
+// identifier.
+func (x *XRef) Refs() map[string][]NodeId {
+	return x.refs
+}
+
+// Def returns the ID of the declaring identifier for the identifier with the
+// given ID, which may be a use or the declaring identifier itself. The bool
+// is false if id is not linked to a declaration in root.
+func (x *XRef) Def(id NodeId) (NodeId, bool) {
+	def, ok := x.defs[id.String()]
+	return def, ok
+}
+
+// Refs is shorthand for NewXRef(root, info).Refs().
+func Refs(root ast.Node, info *types.Info) map[string][]NodeId {
+	return NewXRef(root, info).Refs()
+}